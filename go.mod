@@ -0,0 +1,16 @@
+module github.com/akshayjshah/hardhat
+
+go 1.26.0
+
+require (
+	golang.org/x/tools v0.51.0
+	gopkg.in/alecthomas/kingpin.v2 v2.2.5
+)
+
+require (
+	github.com/alecthomas/assert v1.0.0 // indirect
+	github.com/alecthomas/template v0.0.0-20160405071501-a0175ee3bccc // indirect
+	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
+	golang.org/x/mod v0.41.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
+)
@@ -0,0 +1,77 @@
+// Package bench parses Go benchmark output and compares two sets of results,
+// in the style of benchstat.
+package bench
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Result is a single line of benchmark output.
+type Result struct {
+	// Name includes the GOMAXPROCS suffix, as in "BenchmarkAdd-8".
+	Name       string
+	Iterations int
+	// Values are keyed by unit, like "ns/op" or "allocs/op".
+	Values map[string]float64
+}
+
+// ParseLine parses a line of benchmark output, like
+// "BenchmarkAdd-8   1000000   1.23 ns/op   0 B/op   0 allocs/op".
+func ParseLine(line string) (Result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+		return Result{}, false
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Result{}, false
+	}
+	r := Result{Name: fields[0], Iterations: n, Values: make(map[string]float64)}
+	for i := 2; i+1 < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Result{}, false
+		}
+		r.Values[fields[i+1]] = v
+	}
+	return r, true
+}
+
+// Parse reads benchmark output and returns the results it contains,
+// ignoring everything else.
+func Parse(r io.Reader) ([]Result, error) {
+	var results []Result
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if res, ok := ParseLine(scanner.Text()); ok {
+			results = append(results, res)
+		}
+	}
+	return results, scanner.Err()
+}
+
+// A Key identifies a benchmark.
+type Key struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+}
+
+// Samples collects repeated measurements of benchmarks, keyed by benchmark
+// and then by unit.
+type Samples map[Key]map[string][]float64
+
+// Add records a result from the supplied package.
+func (s Samples) Add(pkg string, r Result) {
+	k := Key{Package: pkg, Name: r.Name}
+	units, ok := s[k]
+	if !ok {
+		units = make(map[string][]float64)
+		s[k] = units
+	}
+	for unit, v := range r.Values {
+		units[unit] = append(units[unit], v)
+	}
+}
@@ -0,0 +1,163 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// Differences with p-values above this aren't statistically significant.
+const alpha = 0.05
+
+// The units reported by go test -benchmem, and the names benchstat gives
+// them.
+var units = []struct{ unit, name string }{
+	{"ns/op", "time/op"},
+	{"MB/s", "speed"},
+	{"B/op", "alloc/op"},
+	{"allocs/op", "allocs/op"},
+}
+
+// A Comparison describes the change in a single benchmark measurement.
+type Comparison struct {
+	Key
+	Unit string  `json:"unit"`
+	Old  Summary `json:"old"`
+	New  Summary `json:"new"`
+	// Delta is the change in the mean, as a percentage of the old mean.
+	Delta       float64 `json:"delta"`
+	P           float64 `json:"p"`
+	Significant bool    `json:"significant"`
+}
+
+// Compare compares two sets of samples. Benchmarks missing from either set
+// are omitted.
+func Compare(old, new Samples) []Comparison {
+	var cs []Comparison
+	for k, newUnits := range new {
+		oldUnits, ok := old[k]
+		if !ok {
+			continue
+		}
+		for _, u := range units {
+			ov, nv := oldUnits[u.unit], newUnits[u.unit]
+			if len(ov) == 0 || len(nv) == 0 {
+				continue
+			}
+			c := Comparison{Key: k, Unit: u.unit, Old: Summarize(ov), New: Summarize(nv)}
+			c.P = MannWhitney(c.Old.Values, c.New.Values)
+			if c.Old.Mean != 0 {
+				c.Delta = 100 * (c.New.Mean - c.Old.Mean) / c.Old.Mean
+			}
+			c.Significant = c.P < alpha
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Unit != cs[j].Unit {
+			return unitOrder(cs[i].Unit) < unitOrder(cs[j].Unit)
+		}
+		if cs[i].Package != cs[j].Package {
+			return cs[i].Package < cs[j].Package
+		}
+		return cs[i].Name < cs[j].Name
+	})
+	return cs
+}
+
+// Regressed reports whether the change is statistically significant and
+// worse than the threshold percentage. Higher values are worse for every unit
+// except throughput.
+func (c Comparison) Regressed(threshold float64) bool {
+	if !c.Significant {
+		return false
+	}
+	if c.Unit == "MB/s" {
+		return -c.Delta > threshold
+	}
+	return c.Delta > threshold
+}
+
+func unitOrder(unit string) int {
+	for i, u := range units {
+		if u.unit == unit {
+			return i
+		}
+	}
+	return len(units)
+}
+
+// WriteTable writes a benchstat-style table, with a section for each unit.
+// Insignificant changes are shown as "~".
+func WriteTable(w io.Writer, cs []Comparison) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for i := 0; i < len(cs); {
+		unit := cs[i].Unit
+		name := unit
+		if o := unitOrder(unit); o < len(units) {
+			name = units[o].name
+		}
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "name\told %s\tnew %s\tdelta\t\n", name, name)
+		pkg := ""
+		for ; i < len(cs) && cs[i].Unit == unit; i++ {
+			c := cs[i]
+			if c.Package != pkg {
+				pkg = c.Package
+				fmt.Fprintf(tw, "pkg: %s\t\t\t\t\n", pkg)
+			}
+			delta := "~"
+			if c.Significant {
+				delta = fmt.Sprintf("%+.2f%%", c.Delta)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t(p=%.3f n=%d+%d)\n",
+				trimName(c.Name), summary(c.Unit, c.Old), summary(c.Unit, c.New), delta, c.P, c.Old.N, c.New.N)
+		}
+	}
+	return tw.Flush()
+}
+
+func trimName(name string) string {
+	if len(name) > len("Benchmark") {
+		return name[len("Benchmark"):]
+	}
+	return name
+}
+
+func summary(unit string, s Summary) string {
+	return fmt.Sprintf("%s ± %.0f%%", Format(unit, s.Mean), 100*s.Spread)
+}
+
+// Format scales a measurement to a readable unit, like "1.23µs" or "4.5kB".
+func Format(unit string, v float64) string {
+	switch unit {
+	case "ns/op":
+		for _, s := range []struct {
+			scale float64
+			name  string
+		}{{1e9, "s"}, {1e6, "ms"}, {1e3, "µs"}} {
+			if math.Abs(v) >= s.scale {
+				return fmt.Sprintf("%.3g%s", v/s.scale, s.name)
+			}
+		}
+		return fmt.Sprintf("%.3gns", v)
+	case "B/op":
+		for _, s := range []struct {
+			scale float64
+			name  string
+		}{{1e9, "GB"}, {1e6, "MB"}, {1e3, "kB"}} {
+			if math.Abs(v) >= s.scale {
+				return fmt.Sprintf("%.3g%s", v/s.scale, s.name)
+			}
+		}
+		return fmt.Sprintf("%.0fB", v)
+	case "MB/s":
+		return fmt.Sprintf("%.3gMB/s", v)
+	default:
+		return fmt.Sprintf("%.3g", v)
+	}
+}
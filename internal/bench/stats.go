@@ -0,0 +1,158 @@
+package bench
+
+import (
+	"math"
+	"sort"
+)
+
+// A Summary describes a set of measurements after removing outliers.
+type Summary struct {
+	Mean float64 `json:"mean"`
+	// Spread is the largest deviation from the mean, as a fraction of the
+	// mean.
+	Spread float64   `json:"spread"`
+	N      int       `json:"n"`
+	Values []float64 `json:"-"`
+}
+
+// Summarize discards outliers, using the same interquartile range rule as
+// benchstat, and summarizes the remaining values.
+func Summarize(values []float64) Summary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	lo, hi := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	var kept []float64
+	for _, v := range sorted {
+		if v >= lo && v <= hi {
+			kept = append(kept, v)
+		}
+	}
+	s := Summary{N: len(kept), Values: kept}
+	if len(kept) == 0 {
+		return s
+	}
+	for _, v := range kept {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(kept))
+	if s.Mean != 0 {
+		s.Spread = math.Max(s.Mean-kept[0], kept[len(kept)-1]-s.Mean) / s.Mean
+	}
+	return s
+}
+
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i]*(1-frac) + sorted[i+1]*frac
+}
+
+// MannWhitney returns the two-sided p-value of the Mann-Whitney U test,
+// which checks whether two samples come from the same distribution without
+// assuming that the distribution is normal. Small samples without ties use
+// the exact distribution of U; others use a normal approximation.
+func MannWhitney(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Assign ranks, averaging across ties.
+	var r1, tieCorrection float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i
+		for j+1 < len(all) && all[j+1].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		if t := float64(j - i + 1); t > 1 {
+			ties = true
+			tieCorrection += t*t*t - t
+		}
+		for k := i; k <= j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		i = j + 1
+	}
+	u := r1 - float64(n1*(n1+1))/2
+
+	if !ties && n1*n2 <= 400 {
+		return exactU(n1, n2, u)
+	}
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// exactU computes the two-sided p-value of U by counting the arrangements
+// of the two samples that produce each value of U.
+func exactU(n1, n2 int, u float64) float64 {
+	max := n1 * n2
+	// counts[i][j][k] is the number of arrangements of i and j observations
+	// with U = k. Only two rows of i are needed at a time.
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, max+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = make([]float64, max+1)
+		cur[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			cur[j] = make([]float64, max+1)
+			for k := 0; k <= i*j; k++ {
+				// Either the largest observation is from the first sample,
+				// and it beats all j of the second, or it's from the second.
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				cur[j][k] += cur[j-1][k]
+			}
+		}
+		prev = cur
+	}
+	dist := prev[n2]
+	var total, below, above float64
+	for k, c := range dist {
+		total += c
+		if float64(k) <= u {
+			below += c
+		}
+		if float64(k) >= u {
+			above += c
+		}
+	}
+	return math.Min(1, 2*math.Min(below, above)/total)
+}
@@ -0,0 +1,65 @@
+package bench
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		{"empty", nil, []float64{1, 2}, 1},
+		// U = 0, and 2 of the C(6, 3) = 20 arrangements are as extreme.
+		{"separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"separated reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 0.1},
+		// U = 0, and 2 of the C(10, 5) = 252 arrangements are as extreme.
+		{"separated larger", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		// U = 3, and 7 of the 20 arrangements have U <= 3.
+		{"interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{"identical with ties", []float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		// U = 3.5 with ties, so the normal approximation applies. This
+		// matches R's wilcox.test with its default continuity correction.
+		{"ties", []float64{1, 2, 2, 3, 4, 4}, []float64{3, 4, 5, 5, 6, 7}, 0.023223192940087675},
+		// 25 * 25 observations is too many for the exact distribution.
+		{"large", seq(1, 25), seq(26, 50), 1.4156562248495634e-09},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MannWhitney(tt.x, tt.y)
+			if math.Abs(got-tt.want) > 1e-9*tt.want {
+				t.Errorf("MannWhitney(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExactU(t *testing.T) {
+	tests := []struct {
+		n1, n2 int
+		u      float64
+		want   float64
+	}{
+		{3, 3, 0, 0.1},
+		{3, 3, 9, 0.1},
+		{3, 3, 4.5, 1},
+		// 2 of the C(8, 4) = 70 arrangements have U <= 1.
+		{4, 4, 1, 4.0 / 70},
+		{4, 4, 15, 4.0 / 70},
+	}
+	for _, tt := range tests {
+		if got := exactU(tt.n1, tt.n2, tt.u); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("exactU(%d, %d, %v) = %v, want %v", tt.n1, tt.n2, tt.u, got, tt.want)
+		}
+	}
+}
+
+func seq(from, to int) []float64 {
+	var s []float64
+	for i := from; i <= to; i++ {
+		s = append(s, float64(i))
+	}
+	return s
+}
@@ -0,0 +1,474 @@
+// Package callgraph builds a conservative call graph from Go source and uses
+// it to find the tests that can reach changed code.
+//
+// The graph is built from syntax alone, without type-checking, so it resolves
+// references by name. A call through a value (x.M()) is assumed to reach every
+// method named M, so calls through interfaces are never missed. Referring to
+// a type reaches all of its methods, since the standard library may call them
+// implicitly (for example, String and MarshalJSON). Code that uses reflection
+// is assumed to reach everything.
+package callgraph
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/discover"
+)
+
+// External test packages are keyed by their import path plus this suffix.
+const xtestSuffix = "_test"
+
+// Each package has a synthetic node for its initialization: package-level
+// variable initializers and init functions. If initialization reaches changed
+// code, every test that loads the package is affected.
+const initName = "#init"
+
+// A method reference (x.M) is recorded as ".M", since the receiver's type is
+// unknown.
+const methodPrefix = "."
+
+type node struct {
+	refs    []string
+	dynamic bool
+}
+
+// A Graph is a call graph over a set of packages. Nodes are package-level
+// declarations, keyed by "importpath.Name" or "importpath.Type.Method".
+type Graph struct {
+	fset    *token.FileSet
+	nodes   map[string]*node
+	methods map[string][]string // method name to method keys
+	types   map[string][]string // type key to method keys
+	imports map[string]map[string]struct{}
+	tests   map[string][]string // package to test function keys
+}
+
+// New constructs an empty graph.
+func New() *Graph {
+	return &Graph{
+		fset:    token.NewFileSet(),
+		nodes:   make(map[string]*node),
+		methods: make(map[string][]string),
+		types:   make(map[string][]string),
+		imports: make(map[string]map[string]struct{}),
+		tests:   make(map[string][]string),
+	}
+}
+
+// A Selection is the set of tests affected by a change.
+type Selection struct {
+	// Tests lists the affected test, benchmark, example, and fuzz functions,
+	// keyed by import path.
+	Tests map[string][]string
+	// Packages lists packages whose tests must all run, usually because
+	// package initialization or TestMain reaches changed code.
+	Packages []string
+}
+
+// AddFile parses a Go source file from the package with the supplied import
+// path and adds its declarations to the graph. Files in external test
+// packages are recognized by their package clause.
+func (g *Graph) AddFile(importPath, filename string, src []byte) error {
+	f, err := parser.ParseFile(g.fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("can't parse %q: %v", filename, err)
+	}
+	pkg := packageKey(importPath, f)
+	test := strings.HasSuffix(filename, "_test.go")
+	imports := fileImports(f)
+	if g.imports[pkg] == nil {
+		g.imports[pkg] = make(map[string]struct{})
+	}
+	for _, path := range imports {
+		g.imports[pkg][path] = struct{}{}
+	}
+	if pkg != importPath {
+		// External tests can use their package's unexported identifiers only
+		// through export_test.go, but they always load it.
+		g.imports[pkg][importPath] = struct{}{}
+	}
+
+	r := &resolver{pkg: pkg, imports: imports}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			key := funcKey(pkg, decl)
+			refs, dynamic := r.refs(decl)
+			switch {
+			case decl.Recv == nil && decl.Name.Name == "init":
+				key = pkg + "." + initName
+			case decl.Recv != nil:
+				name := decl.Name.Name
+				g.methods[name] = append(g.methods[name], key)
+				typ := pkg + "." + receiverType(decl)
+				g.types[typ] = append(g.types[typ], key)
+			case test && discover.KindOf(f, decl) != discover.KindUnknown:
+				g.tests[pkg] = append(g.tests[pkg], key)
+			}
+			g.add(key, refs, dynamic)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				refs, dynamic := r.refs(spec)
+				if decl.Tok == token.VAR && hasBlank(spec) {
+					g.add(pkg+"."+initName, refs, dynamic)
+				}
+				for _, name := range specNames(spec) {
+					key := pkg + "." + name
+					g.add(key, refs, dynamic)
+					if decl.Tok == token.VAR {
+						// Variable initializers run when the package loads.
+						g.add(pkg+"."+initName, []string{key}, false)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Graph) add(key string, refs []string, dynamic bool) {
+	n, ok := g.nodes[key]
+	if !ok {
+		n = &node{}
+		g.nodes[key] = n
+	}
+	n.refs = append(n.refs, refs...)
+	n.dynamic = n.dynamic || dynamic
+}
+
+// targets resolves a node's references to the keys of other nodes.
+func (g *Graph) targets(key string, n *node) []string {
+	var ts []string
+	for _, ref := range n.refs {
+		if strings.HasPrefix(ref, methodPrefix) {
+			ts = append(ts, g.methods[strings.TrimPrefix(ref, methodPrefix)]...)
+			continue
+		}
+		if _, ok := g.nodes[ref]; ok {
+			ts = append(ts, ref)
+		}
+	}
+	return append(ts, g.types[key]...)
+}
+
+// Select returns the tests that can reach any of the changed declarations.
+// Changed keys come from ChangedDecls.
+func (g *Graph) Select(changed []string) Selection {
+	affected := make(map[string]struct{})
+	var queue []string
+	for _, key := range changed {
+		if _, ok := affected[key]; !ok {
+			affected[key] = struct{}{}
+			queue = append(queue, key)
+		}
+	}
+	if len(changed) > 0 {
+		// Reflection can reach anything.
+		for key, n := range g.nodes {
+			if _, ok := affected[key]; n.dynamic && !ok {
+				affected[key] = struct{}{}
+				queue = append(queue, key)
+			}
+		}
+	}
+
+	callers := make(map[string][]string)
+	for key, n := range g.nodes {
+		for _, t := range g.targets(key, n) {
+			callers[t] = append(callers[t], key)
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[key] {
+			if _, ok := affected[caller]; !ok {
+				affected[caller] = struct{}{}
+				queue = append(queue, caller)
+			}
+		}
+	}
+
+	full := make(map[string]struct{})
+	for pkg := range g.imports {
+		_, initialized := affected[pkg+"."+initName]
+		_, testMain := affected[pkg+".TestMain"]
+		if initialized {
+			for _, importer := range g.importers(pkg) {
+				full[goPackage(importer)] = struct{}{}
+			}
+		}
+		if initialized || testMain {
+			full[goPackage(pkg)] = struct{}{}
+		}
+	}
+
+	sel := Selection{Tests: make(map[string][]string)}
+	for pkg := range full {
+		sel.Packages = append(sel.Packages, pkg)
+	}
+	sort.Strings(sel.Packages)
+	for pkg, tests := range g.tests {
+		gopkg := goPackage(pkg)
+		if _, ok := full[gopkg]; ok {
+			continue
+		}
+		for _, key := range tests {
+			if _, ok := affected[key]; ok {
+				sel.Tests[gopkg] = append(sel.Tests[gopkg], strings.TrimPrefix(key, pkg+"."))
+			}
+		}
+	}
+	for _, names := range sel.Tests {
+		sort.Strings(names)
+	}
+	return sel
+}
+
+// importers returns the packages in the graph that transitively import pkg.
+func (g *Graph) importers(pkg string) []string {
+	seen := map[string]struct{}{pkg: {}}
+	queue := []string{pkg}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for importer, imports := range g.imports {
+			if _, ok := imports[cur]; !ok {
+				continue
+			}
+			if _, ok := seen[importer]; !ok {
+				seen[importer] = struct{}{}
+				queue = append(queue, importer)
+			}
+		}
+	}
+	all := make([]string, 0, len(seen))
+	for p := range seen {
+		all = append(all, p)
+	}
+	return all
+}
+
+// ChangedDecls compares two versions of a file from the package with the
+// supplied import path and returns the keys of the declarations that were
+// added, removed, or modified. Either version may be nil, if the file was
+// added or deleted. Changes to comments and imports are ignored.
+func ChangedDecls(importPath, filename string, old, new []byte) ([]string, error) {
+	before, err := declSources(importPath, filename, old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := declSources(importPath, filename, new)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for key, src := range after {
+		if prev, ok := before[key]; !ok || prev != src {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// declSources prints each declaration in a file, without comments, keyed
+// like the graph's nodes.
+func declSources(importPath, filename string, src []byte) (map[string]string, error) {
+	sources := make(map[string]string)
+	if src == nil {
+		return sources, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %q: %v", filename, err)
+	}
+	pkg := packageKey(importPath, f)
+	print := func(n ast.Node) string {
+		buf := bytes.NewBuffer(nil)
+		printer.Fprint(buf, fset, n)
+		return buf.String()
+	}
+	inits := 0
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			key := funcKey(pkg, decl)
+			if decl.Recv == nil && decl.Name.Name == "init" {
+				// A file may have several init functions.
+				key = pkg + "." + initName
+				inits++
+				sources[key] += strconv.Itoa(inits) + print(decl)
+				continue
+			}
+			sources[key] = print(decl)
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				src := print(spec)
+				if decl.Tok == token.CONST {
+					// Reordering constants can change their values.
+					src = print(decl)
+				}
+				if decl.Tok == token.VAR && hasBlank(spec) {
+					sources[pkg+"."+initName] += src
+				}
+				for _, name := range specNames(spec) {
+					sources[pkg+"."+name] = src
+				}
+			}
+		}
+	}
+	return sources, nil
+}
+
+// A resolver turns the identifiers in a declaration into references to other
+// nodes.
+type resolver struct {
+	pkg     string
+	imports map[string]string // local name to import path
+}
+
+func (r *resolver) refs(n ast.Node) ([]string, bool) {
+	var refs []string
+	dynamic := false
+	var inspect func(ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				if path, ok := r.imports[x.Name]; ok {
+					if path == "reflect" {
+						dynamic = true
+					}
+					refs = append(refs, path+"."+n.Sel.Name)
+					return false
+				}
+			}
+			refs = append(refs, methodPrefix+n.Sel.Name)
+			// Only the receiver needs resolving; the selected name isn't a
+			// package-level identifier.
+			ast.Inspect(n.X, inspect)
+			return false
+		case *ast.Ident:
+			refs = append(refs, r.pkg+"."+n.Name)
+			if path, ok := r.imports["."]; ok {
+				refs = append(refs, path+"."+n.Name)
+			}
+		}
+		return true
+	}
+	ast.Inspect(n, inspect)
+	return refs, dynamic
+}
+
+// fileImports maps the names that a file's imports are referred to by to
+// their import paths. Dot imports are keyed by ".".
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string, len(f.Imports))
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" {
+			continue
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+func packageKey(importPath string, f *ast.File) string {
+	if strings.HasSuffix(f.Name.Name, xtestSuffix) {
+		return importPath + xtestSuffix
+	}
+	return importPath
+}
+
+// goPackage converts a graph package key to the import path that go test
+// understands.
+func goPackage(pkg string) string {
+	return strings.TrimSuffix(pkg, xtestSuffix)
+}
+
+func funcKey(pkg string, fn *ast.FuncDecl) string {
+	if fn.Recv == nil {
+		return pkg + "." + fn.Name.Name
+	}
+	return pkg + "." + receiverType(fn) + "." + fn.Name.Name
+}
+
+// receiverType returns the name of a method's receiver type, without any
+// pointer or type parameters.
+func receiverType(fn *ast.FuncDecl) string {
+	if len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		names := make([]string, 0, len(s.Names))
+		for _, n := range s.Names {
+			if n.Name != "_" {
+				names = append(names, n.Name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// hasBlank reports whether a value spec declares the blank identifier, as in
+// "var _ = register()".
+func hasBlank(spec ast.Spec) bool {
+	if s, ok := spec.(*ast.ValueSpec); ok {
+		for _, n := range s.Names {
+			if n.Name == "_" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package callgraph
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testPkg = "example.com/p"
+
+func TestChangedDecls(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		old, new string
+		want     []string
+	}{
+		{
+			name: "comments and imports",
+			old:  "package p\n\nimport \"fmt\"\n\nfunc F() {}\n",
+			new:  "package p\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\n// F does nothing.\nfunc F() { /* still nothing */ }\n",
+		},
+		{
+			name: "function body",
+			old:  "package p\n\nfunc F() int { return 1 }\n\nfunc G() {}\n",
+			new:  "package p\n\nfunc F() int { return 2 }\n\nfunc G() {}\n",
+			want: []string{"example.com/p.F"},
+		},
+		{
+			name: "added and removed functions",
+			old:  "package p\n\nfunc F() {}\n",
+			new:  "package p\n\nfunc G() {}\n",
+			want: []string{"example.com/p.F", "example.com/p.G"},
+		},
+		{
+			name: "pointer method",
+			old:  "package p\n\ntype T struct{}\n\nfunc (t *T) M() int { return 1 }\n",
+			new:  "package p\n\ntype T struct{}\n\nfunc (t *T) M() int { return 2 }\n",
+			want: []string{"example.com/p.T.M"},
+		},
+		{
+			name: "generic methods",
+			old:  "package p\n\nfunc (b Box[T]) Get() {}\n\nfunc (p *Pair[K, V]) Key() {}\n",
+			new:  "package p\n\nfunc (b Box[T]) Get() { _ = 1 }\n\nfunc (p *Pair[K, V]) Key() { _ = 1 }\n",
+			want: []string{"example.com/p.Box.Get", "example.com/p.Pair.Key"},
+		},
+		{
+			name: "init functions",
+			old:  "package p\n\nfunc init() {}\n\nfunc init() {}\n",
+			new:  "package p\n\nfunc init() {}\n\nfunc init() { println() }\n",
+			want: []string{"example.com/p.#init"},
+		},
+		{
+			name: "blank variable initializer",
+			old:  "package p\n\nvar _ = register(1)\n",
+			new:  "package p\n\nvar _ = register(2)\n",
+			want: []string{"example.com/p.#init"},
+		},
+		{
+			name: "reordered constants",
+			old:  "package p\n\nconst (\n\tA = iota\n\tB\n)\n",
+			new:  "package p\n\nconst (\n\tB = iota\n\tA\n)\n",
+			want: []string{"example.com/p.A", "example.com/p.B"},
+		},
+		{
+			name: "added file",
+			new:  "package p\n\ntype T int\n\nvar V, W = 1, 2\n",
+			want: []string{"example.com/p.T", "example.com/p.V", "example.com/p.W"},
+		},
+		{
+			name:     "external test",
+			filename: "p_test.go",
+			old:      "package p_test\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) {}\n",
+			new:      "package p_test\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { t.Skip() }\n",
+			want:     []string{"example.com/p_test.TestF"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := tt.filename
+			if filename == "" {
+				filename = "p.go"
+			}
+			var old, new []byte
+			if tt.old != "" {
+				old = []byte(tt.old)
+			}
+			if tt.new != "" {
+				new = []byte(tt.new)
+			}
+			got, err := ChangedDecls(testPkg, filename, old, new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedDecls() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	// Files are keyed by import path, then file name.
+	type files map[string]map[string]string
+	tests := []struct {
+		name     string
+		files    files
+		changed  []string
+		tests    map[string][]string
+		packages []string
+	}{
+		{
+			name: "method called through an interface",
+			files: files{testPkg: {
+				"p.go": `package p
+
+type Shape interface{ Area() int }
+
+type Square struct{ n int }
+
+func (s Square) Area() int { return s.n * s.n }
+
+func Total(shapes []Shape) (t int) {
+	for _, s := range shapes {
+		t += s.Area()
+	}
+	return t
+}
+
+func Other() {}
+`,
+				"p_test.go": `package p
+
+import "testing"
+
+func TestTotal(t *testing.T) { Total(nil) }
+
+func TestOther(t *testing.T) { Other() }
+`,
+			}},
+			changed: []string{"example.com/p.Square.Area"},
+			tests:   map[string][]string{testPkg: {"TestTotal"}},
+		},
+		{
+			name: "method reached through its generic type",
+			files: files{testPkg: {
+				"p.go": `package p
+
+type Pair[K comparable, V any] struct {
+	k K
+	v V
+}
+
+func (p Pair[K, V]) Key() K { return p.k }
+
+func NewPair() Pair[string, int] { return Pair[string, int]{} }
+
+func Other() {}
+`,
+				"p_test.go": `package p
+
+import "testing"
+
+func TestPair(t *testing.T) { NewPair() }
+
+func TestOther(t *testing.T) { Other() }
+`,
+			}},
+			changed: []string{"example.com/p.Pair.Key"},
+			tests:   map[string][]string{testPkg: {"TestPair"}},
+		},
+		{
+			name: "init function",
+			files: files{
+				testPkg: {
+					"p.go": `package p
+
+func init() { setup() }
+
+func setup() {}
+
+func F() {}
+`,
+					"p_test.go": "package p\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F() }\n",
+				},
+				"example.com/q": {
+					"q.go":      "package q\n\nimport \"example.com/p\"\n\nfunc G() { p.F() }\n",
+					"q_test.go": "package q\n\nimport \"testing\"\n\nfunc TestG(t *testing.T) {}\n",
+				},
+				"example.com/r": {
+					"r_test.go": "package r\n\nimport \"testing\"\n\nfunc TestR(t *testing.T) {}\n",
+				},
+			},
+			changed:  []string{"example.com/p.setup"},
+			packages: []string{testPkg, "example.com/q"},
+		},
+		{
+			name: "blank variable initializer",
+			files: files{testPkg: {
+				"p.go": `package p
+
+var _ = register()
+
+func register() bool { return true }
+
+func F() {}
+`,
+				"p_test.go": "package p\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F() }\n",
+			}},
+			changed:  []string{"example.com/p.register"},
+			packages: []string{testPkg},
+		},
+		{
+			name: "TestMain",
+			files: files{
+				testPkg: {
+					"p.go": "package p\n\nfunc Setup() {}\n\nfunc F() {}\n",
+					"p_test.go": `package p
+
+import "testing"
+
+func TestMain(m *testing.M) { Setup() }
+
+func TestF(t *testing.T) { F() }
+`,
+				},
+				"example.com/q": {
+					"q.go":      "package q\n\nimport \"example.com/p\"\n\nfunc G() { p.F() }\n",
+					"q_test.go": "package q\n\nimport \"testing\"\n\nfunc TestG(t *testing.T) { G() }\n",
+				},
+			},
+			changed:  []string{"example.com/p.Setup"},
+			packages: []string{testPkg},
+		},
+		{
+			name: "reflection",
+			files: files{testPkg: {
+				"p.go": `package p
+
+import "reflect"
+
+func Dyn(v interface{}) string { return reflect.TypeOf(v).String() }
+
+func F() {}
+
+func G() {}
+`,
+				"p_test.go": `package p
+
+import "testing"
+
+func TestDyn(t *testing.T) { Dyn(1) }
+
+func TestF(t *testing.T) { F() }
+
+func TestG(t *testing.T) { G() }
+`,
+			}},
+			changed: []string{"example.com/p.F"},
+			tests:   map[string][]string{testPkg: {"TestDyn", "TestF"}},
+		},
+		{
+			name: "external test through another package",
+			files: files{
+				testPkg: {
+					"p.go":      "package p\n\nfunc F() {}\n",
+					"p_test.go": "package p_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/q\"\n)\n\nfunc TestViaQ(t *testing.T) { q.G() }\n",
+				},
+				"example.com/q": {
+					"q.go": "package q\n\nimport \"example.com/p\"\n\nfunc G() { p.F() }\n",
+				},
+			},
+			changed: []string{"example.com/p.F"},
+			tests:   map[string][]string{testPkg: {"TestViaQ"}},
+		},
+		{
+			name: "nothing changed",
+			files: files{testPkg: {
+				"p.go":      "package p\n\nimport \"reflect\"\n\nvar T = reflect.TypeOf(0)\n",
+				"p_test.go": "package p\n\nimport \"testing\"\n\nfunc TestT(t *testing.T) { _ = T }\n",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			for pkg, srcs := range tt.files {
+				for name, src := range srcs {
+					if err := g.AddFile(pkg, name, []byte(src)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			sel := g.Select(tt.changed)
+			want := Selection{Tests: tt.tests, Packages: tt.packages}
+			if want.Tests == nil {
+				want.Tests = make(map[string][]string)
+			}
+			if !reflect.DeepEqual(sel, want) {
+				t.Errorf("Select(%v) = %+v, want %+v", tt.changed, sel, want)
+			}
+		})
+	}
+}
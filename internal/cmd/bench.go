@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/bench"
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/gotest"
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type benchCmd struct {
+	p      *project.Project
+	store  *history.Store
+	logger *hhlog.Logger
+
+	all         bool
+	direct      bool
+	base        string
+	pattern     string
+	count       int
+	benchtime   string
+	json        bool
+	stored      bool
+	gate        bool
+	threshold   float64
+	jsonReport  string
+	junitReport string
+}
+
+// A benchTree is a checkout of the project whose benchmarks we're running.
+type benchTree struct {
+	name string
+	dir  string
+	env  []string
+	// binaries maps import paths to compiled test binaries.
+	binaries map[string]string
+	samples  bench.Samples
+}
+
+func addBench(app *kingpin.Application, p *project.Project, s *history.Store, l *hhlog.Logger) {
+	b := &benchCmd{p: p, store: s, logger: l}
+	cmd := app.Command("bench", "Compare benchmarks against the merge base.").Action(b.run)
+	cmd.Flag("direct", "Include only directly modified packages.").
+		Short('d').
+		BoolVar(&b.direct)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&b.base)
+	cmd.Flag("all", "Run benchmarks in all packages.").
+		Short('a').
+		BoolVar(&b.all)
+	cmd.Flag("bench", "Run only benchmarks matching a regexp.").
+		Default(".").
+		StringVar(&b.pattern)
+	cmd.Flag("count", "Number of times to run each benchmark at each commit.").
+		Short('n').
+		Default("6").
+		IntVar(&b.count)
+	cmd.Flag("benchtime", "Run each benchmark for this long, or this many iterations with an \"x\" suffix.").
+		StringVar(&b.benchtime)
+	cmd.Flag("json", "Format output as JSON.").
+		BoolVar(&b.json)
+	cmd.Flag("stored-baseline", "Compare against results stored by a previous run at the merge base, rather than running its benchmarks again.").
+		BoolVar(&b.stored)
+	cmd.Flag("gate", "Fail if any benchmark regresses by more than the gate threshold.").
+		BoolVar(&b.gate)
+	cmd.Flag("gate-threshold", "Percentage by which a benchmark must significantly regress to fail the gate.").
+		Default("5").
+		FloatVar(&b.threshold)
+	cmd.Flag("json-report", "Write a JSON report of any regressions to this file.").
+		PlaceHolder("FILE").
+		StringVar(&b.jsonReport)
+	cmd.Flag("junit-report", "Write a JUnit XML report of any regressions to this file.").
+		PlaceHolder("FILE").
+		StringVar(&b.junitReport)
+}
+
+func (b *benchCmd) run(_ *kingpin.ParseContext) error {
+	pkgs, err := b.packages()
+	if err != nil {
+		return b.logger.Annotate(err)
+	}
+	if len(pkgs) == 0 {
+		b.logger.Printf("No affected packages have benchmarks.")
+		return nil
+	}
+	mergeBase, err := b.p.MergeBase(b.base)
+	if err != nil {
+		return b.logger.Annotate(err)
+	}
+	stored, err := b.store.Benchmarks()
+	if err != nil {
+		return b.logger.Annotate(err)
+	}
+	bins, cleanup, err := tempDir("hardhat-bench")
+	if err != nil {
+		return b.logger.Annotate(err)
+	}
+	defer cleanup()
+
+	head := &benchTree{name: "HEAD", dir: b.p.Dir(), env: os.Environ()}
+	old := &benchTree{name: short(mergeBase)}
+	trees := []*benchTree{head}
+	if b.stored {
+		old.samples = stored.Samples(mergeBase)
+		if old.samples == nil {
+			return b.logger.Annotate(fmt.Errorf("no benchmark results are stored for %s", old.name))
+		}
+	} else {
+		dir, env, removeWorktree, err := b.p.Worktree(mergeBase)
+		if err != nil {
+			return b.logger.Annotate(err)
+		}
+		defer removeWorktree()
+		old.dir, old.env = dir, env
+		if err := b.compile(old, pkgs, filepath.Join(bins, "base"), false); err != nil {
+			return b.logger.Annotate(err)
+		}
+		trees = append(trees, old)
+	}
+	if err := b.compile(head, pkgs, filepath.Join(bins, "head"), true); err != nil {
+		return b.logger.Annotate(err)
+	}
+
+	b.logger.Printf("Running benchmarks in %d packages %d times each.", len(pkgs), b.count)
+	for round := 0; round < b.count; round++ {
+		// Alternate which commit goes first, so that drift in machine load
+		// affects both equally.
+		order := append([]*benchTree(nil), trees...)
+		if round%2 == 1 {
+			for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+				order[i], order[j] = order[j], order[i]
+			}
+		}
+		for _, pkg := range pkgs {
+			for _, tree := range order {
+				if err := b.invoke(tree, pkg); err != nil {
+					return b.logger.Annotate(err)
+				}
+			}
+		}
+	}
+	b.record(stored, mergeBase, head, old)
+
+	comparisons := bench.Compare(old.samples, head.samples)
+	report := gotest.Report{}
+	for _, c := range comparisons {
+		if c.Regressed(b.threshold) {
+			report.Regressions = append(report.Regressions, gotest.Regression{
+				Package:   c.Package,
+				Benchmark: c.Name,
+				Unit:      c.Unit,
+				Old:       c.Old.Mean,
+				New:       c.New.Mean,
+				Delta:     c.Delta,
+				P:         c.P,
+			})
+		}
+	}
+	if err := writeReports(report, b.jsonReport, b.junitReport); err != nil {
+		return b.logger.Annotate(err)
+	}
+	if err := b.print(comparisons, pkgs, old); err != nil {
+		return b.logger.Annotate(err)
+	}
+	if b.gate && len(report.Regressions) > 0 {
+		return b.logger.Annotate(fmt.Errorf("%d benchmark measurements regressed by more than %.1f%%", len(report.Regressions), b.threshold))
+	}
+	return nil
+}
+
+func (b *benchCmd) print(comparisons []bench.Comparison, pkgs []string, old *benchTree) error {
+	if b.json {
+		bs, err := json.Marshal(comparisons)
+		if err != nil {
+			return err
+		}
+		b.logger.Printf("%s", bs)
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := bench.WriteTable(buf, comparisons); err != nil {
+		return err
+	}
+	var added []string
+	for _, pkg := range pkgs {
+		if !old.has(pkg) {
+			added = append(added, pkg)
+		}
+	}
+	if len(added) > 0 {
+		fmt.Fprintf(buf, "\nNo benchmarks to compare against at %s:\n\t%s\n", old.name, strings.Join(added, "\n\t"))
+	}
+	b.logger.Printf("%s", strings.TrimSpace(buf.String()))
+	return nil
+}
+
+// record stores the results from this run as baselines for future runs.
+// Results from a dirty working tree don't describe any commit, so they're
+// discarded.
+func (b *benchCmd) record(stored *history.Benchmarks, mergeBase string, head, old *benchTree) {
+	now := time.Now()
+	if !b.stored {
+		stored.Record(mergeBase, old.samples, now)
+	}
+	dirty, err := b.p.Dirty()
+	if err != nil {
+		b.logger.Printf("Couldn't check for uncommitted changes, so results for HEAD won't be stored: %v", err)
+	} else if !dirty {
+		if sha, err := b.p.Canonicalize("HEAD"); err == nil {
+			stored.Record(sha, head.samples, now)
+		}
+	}
+	if err := b.store.SaveBenchmarks(stored); err != nil {
+		b.logger.Printf("Couldn't save benchmark results: %v", err)
+	}
+}
+
+// has reports whether the tree has benchmark results for a package.
+func (t *benchTree) has(pkg string) bool {
+	if _, ok := t.binaries[pkg]; ok {
+		return true
+	}
+	for k := range t.samples {
+		if k.Package == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// packages returns the affected packages that have benchmarks.
+func (b *benchCmd) packages() ([]string, error) {
+	var d project.Diff
+	var err error
+	if b.all {
+		d, err = b.p.All()
+	} else if b.direct {
+		d, err = b.p.Diff(b.base)
+	} else {
+		d, err = b.p.RecursiveDiff(b.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(b.p.Dir(), b.p.PackageDir(pd.Path), "*_test.go"))
+		if err != nil {
+			return nil, err
+		}
+		if hasBenchmarks(files) {
+			pkgs = append(pkgs, pd.Path)
+		}
+	}
+	return pkgs, nil
+}
+
+func hasBenchmarks(files []string) bool {
+	for _, file := range files {
+		funcs, err := discover.File(file)
+		if err != nil {
+			// Let the go tool report the error.
+			return true
+		}
+		for _, fn := range funcs {
+			if fn.Kind == discover.KindBenchmark {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compile builds a test binary for each package, so that compilation doesn't
+// add noise to the benchmarks. Packages that don't exist or don't compile at
+// the merge base are skipped.
+func (b *benchCmd) compile(tree *benchTree, pkgs []string, out string, required bool) error {
+	tree.binaries = make(map[string]string, len(pkgs))
+	tree.samples = make(bench.Samples)
+	for i, pkg := range pkgs {
+		dir := b.p.PackageDir(pkg)
+		if _, err := os.Stat(filepath.Join(tree.dir, dir)); err != nil {
+			continue
+		}
+		bin := filepath.Join(out, fmt.Sprintf("%d.test", i))
+		c := b.command(tree, tree.dir, "go", "test", "-c", "-o", bin, "./"+filepath.ToSlash(dir))
+		if output, err := c.CombinedOutput(); err != nil {
+			if required {
+				return fmt.Errorf("can't compile tests for %s at %s: %v\n%s", pkg, tree.name, err, output)
+			}
+			b.logger.Printf("Couldn't compile tests for %s at %s, so its benchmarks won't be compared: %v", pkg, tree.name, err)
+			continue
+		}
+		if _, err := os.Stat(bin); err != nil {
+			// The package has no tests at this commit.
+			continue
+		}
+		tree.binaries[pkg] = bin
+	}
+	return nil
+}
+
+func (b *benchCmd) invoke(tree *benchTree, pkg string) error {
+	bin, ok := tree.binaries[pkg]
+	if !ok {
+		return nil
+	}
+	args := []string{"-test.run=^$", "-test.bench=" + b.pattern, "-test.benchmem", "-test.count=1"}
+	if b.benchtime != "" {
+		args = append(args, "-test.benchtime="+b.benchtime)
+	}
+	c := b.command(tree, filepath.Join(tree.dir, b.p.PackageDir(pkg)), bin, args...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("benchmarks for %s failed at %s: %v\n%s", pkg, tree.name, err, out)
+	}
+	results, err := bench.Parse(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		tree.samples.Add(pkg, r)
+	}
+	return nil
+}
+
+func (b *benchCmd) command(tree *benchTree, dir, name string, args ...string) *exec.Cmd {
+	b.logger.Debugf("running %s %s in %s", name, strings.Join(args, " "), dir)
+	c := exec.Command(name, args...)
+	c.Dir = dir
+	c.Env = tree.env
+	return c
+}
@@ -0,0 +1,523 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Binaries are compared against the base commit, and each is one of these.
+// A binary is affected when it depends on a changed package, which doesn't
+// guarantee that the bytes of its output differ.
+const (
+	binaryNew        = "new"
+	binaryAffected   = "affected"
+	binaryUnaffected = "unaffected"
+)
+
+// Cross-compiled binaries are listed with their checksums in this file, in
+// the bin directory.
+const checksumsFile = "SHA256SUMS"
+
+type buildCmd struct {
+	p      *project.Project
+	logger *hhlog.Logger
+
+	all       bool
+	direct    bool
+	base      string
+	bin       string
+	output    string
+	platforms string
+	workers   int
+	tags      string
+	trimpath  bool
+	ldflags   string
+	stamps    []string
+	manifest  bool
+	json      bool
+
+	sizeReport    bool
+	sizeThreshold float64
+
+	stamp     stamp
+	stampVars []stampVar
+	// stampFlags sets the stamped variables, in go build's -ldflags syntax.
+	stampFlags string
+}
+
+// A binary is a main package and the file it's built into.
+type binary struct {
+	Package  string `json:"package"`
+	Platform string `json:"platform,omitempty"`
+	Path     string `json:"path"`
+	// Status compares the binary to the base commit.
+	Status   string `json:"status"`
+	SHA256   string `json:"sha256,omitempty"`
+	Manifest string `json:"manifest,omitempty"`
+	// Size compares the binary to the one built at the merge base.
+	Size  *binarySize `json:"size,omitempty"`
+	Error string      `json:"error,omitempty"`
+
+	// p analyzes and builds the project for the binary's platform.
+	p *project.Project
+}
+
+// binaryName supplies the fields available to --output templates.
+type binaryName struct {
+	Name    string // last element of the import path
+	Package string // import path
+	Dir     string // directory, relative to the repository root
+	GOOS    string
+	GOARCH  string
+	Ext     string // ".exe" on Windows
+}
+
+func addBuild(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
+	b := &buildCmd{p: p, logger: l}
+	cmd := app.Command("build", "Build affected main packages.").Action(b.run)
+	cmd.Flag("direct", "Include only directly modified packages.").
+		Short('d').
+		BoolVar(&b.direct)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&b.base)
+	cmd.Flag("all", "Build all main packages.").
+		Short('a').
+		BoolVar(&b.all)
+	cmd.Flag("bin", "Directory to write binaries to, relative to the repository root.").
+		Default("bin").
+		StringVar(&b.bin)
+	cmd.Flag("output", "Template for binary names, relative to the bin directory. Fields are .Name, .Package, .Dir, .GOOS, .GOARCH, and .Ext. Defaults to \"{{.Name}}{{.Ext}}\", or \"{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}\" with --platforms.").
+		Short('o').
+		StringVar(&b.output)
+	cmd.Flag("platforms", "Cross-compile for these comma-separated GOOS/GOARCH pairs, deciding which packages are affected separately for each.").
+		PlaceHolder("linux/amd64,darwin/arm64").
+		StringVar(&b.platforms)
+	cmd.Flag("workers", "Number of concurrent go build invocations.").
+		Short('p').
+		Default(strconv.Itoa(runtime.NumCPU())).
+		IntVar(&b.workers)
+	cmd.Flag("tags", "Comma-separated build tags.").
+		StringVar(&b.tags)
+	cmd.Flag("trimpath", "Remove file system paths from the binaries.").
+		BoolVar(&b.trimpath)
+	cmd.Flag("ldflags", "Flags to pass to the linker.").
+		StringVar(&b.ldflags)
+	cmd.Flag("stamp", "Set a string variable to a value from git, in the form FIELD=package.Variable. Fields are version (git describe), commit, dirty, time, and branch. Repeatable.").
+		PlaceHolder("FIELD=VAR").
+		StringsVar(&b.stamps)
+	cmd.Flag("manifest", "Write a JSON manifest describing each binary and the commit it was built from next to it.").
+		BoolVar(&b.manifest)
+	cmd.Flag("size-report", "Also build each binary at the merge base and report how much it grew, broken down by package.").
+		BoolVar(&b.sizeReport)
+	cmd.Flag("size-threshold", "Fail if any binary grows by more than this percentage, or if its size can't be compared. Implies --size-report.").
+		PlaceHolder("PERCENT").
+		FloatVar(&b.sizeThreshold)
+	cmd.Flag("json", "Format output as JSON.").
+		BoolVar(&b.json)
+}
+
+func (b *buildCmd) run(_ *kingpin.ParseContext) error {
+	projects, err := b.projects()
+	if err != nil {
+		return b.logger.Annotate(err)
+	}
+	output := b.output
+	if output == "" {
+		output = "{{.Name}}{{.Ext}}"
+		if b.platforms != "" {
+			output = "{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}"
+		}
+	}
+	tmpl, err := template.New("output").Parse(output)
+	if err != nil {
+		return b.logger.Annotate(fmt.Errorf("invalid --output template: %v", err))
+	}
+	if b.stampVars, err = parseStampVars(b.stamps); err != nil {
+		return b.logger.Annotate(err)
+	}
+	if len(b.stampVars) > 0 || b.manifest {
+		if b.stamp, err = newStamp(b.p); err != nil {
+			return b.logger.Annotate(err)
+		}
+		if b.stampFlags, err = b.stamp.ldflags(b.stampVars); err != nil {
+			return b.logger.Annotate(err)
+		}
+	}
+	var binaries []binary
+	for _, p := range projects {
+		bins, err := b.binaries(p, tmpl)
+		if err != nil {
+			return b.logger.Annotate(err)
+		}
+		binaries = append(binaries, bins...)
+	}
+	if len(binaries) == 0 {
+		b.logger.Printf("No main packages need to be built.")
+		return nil
+	}
+	written := make(map[string]binary, len(binaries))
+	for _, bin := range binaries {
+		if prev, ok := written[bin.Path]; ok {
+			return b.logger.Annotate(fmt.Errorf("%s and %s would both be built to %s; include the platform in --output", prev.describe(), bin.describe(), bin.Path))
+		}
+		written[bin.Path] = bin
+	}
+
+	failed := b.parallel(binaries, b.build)
+	if b.platforms != "" {
+		if err := b.writeChecksums(binaries); err != nil {
+			return b.logger.Annotate(err)
+		}
+	}
+	var grown, incomparable int
+	if (b.sizeReport || b.sizeThreshold > 0) && failed < len(binaries) {
+		if grown, incomparable, err = b.compareSizes(binaries); err != nil {
+			return b.logger.Annotate(err)
+		}
+	}
+	if b.json {
+		bs, err := json.Marshal(binaries)
+		if err != nil {
+			return b.logger.Annotate(err)
+		}
+		b.logger.Printf("%s", bs)
+	} else {
+		b.logger.Printf("%s", formatBinaries(binaries))
+		if b.sizeReport || b.sizeThreshold > 0 {
+			b.logger.Printf("%s", formatSizes(binaries))
+		}
+	}
+	if failed > 0 {
+		return b.logger.Annotate(fmt.Errorf("%d of %d binaries failed to build", failed, len(binaries)))
+	}
+	if b.sizeThreshold > 0 && incomparable > 0 {
+		return b.logger.Annotate(fmt.Errorf("couldn't compare the sizes of %d binaries, so the size threshold can't be checked", incomparable))
+	}
+	if grown > 0 {
+		return b.logger.Annotate(fmt.Errorf("%d binaries grew by more than %.1f%%", grown, b.sizeThreshold))
+	}
+	return nil
+}
+
+// projects returns a copy of the project for each platform in --platforms,
+// or just the project itself if there aren't any.
+func (b *buildCmd) projects() ([]*project.Project, error) {
+	if b.platforms == "" {
+		return []*project.Project{b.p}, nil
+	}
+	var tags []string
+	if b.tags != "" {
+		tags = strings.Split(b.tags, ",")
+	}
+	seen := make(map[string]struct{})
+	var projects []*project.Project
+	for _, platform := range strings.Split(b.platforms, ",") {
+		platform = strings.TrimSpace(platform)
+		if platform == "" {
+			continue
+		}
+		t, err := project.ParseTarget(platform)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[t.Platform()]; ok {
+			continue
+		}
+		seen[t.Platform()] = struct{}{}
+		t.Tags = tags
+		projects = append(projects, b.p.WithTarget(t))
+	}
+	return projects, nil
+}
+
+// parallel calls fn on each binary concurrently, recording any errors on the
+// binaries, and returns the number that failed.
+func (b *buildCmd) parallel(binaries []binary, fn func(*binary) error) int {
+	workers := b.workers
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu     sync.Mutex
+		failed int
+		wg     sync.WaitGroup
+	)
+	queue := make(chan *binary)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bin := range queue {
+				if err := fn(bin); err != nil {
+					bin.Error = err.Error()
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range binaries {
+		queue <- &binaries[i]
+	}
+	close(queue)
+	wg.Wait()
+	return failed
+}
+
+// binaries finds the main packages to build and decides where to put them.
+// With a target, only packages and files that the target builds are
+// considered.
+func (b *buildCmd) binaries(p *project.Project, tmpl *template.Template) ([]binary, error) {
+	var changed project.Diff
+	var err error
+	if b.direct {
+		changed, err = p.Diff(b.base)
+	} else {
+		changed, err = p.RecursiveDiff(b.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := changed
+	if b.all {
+		if d, err = p.All(); err != nil {
+			return nil, err
+		}
+	}
+	affected := make(map[string]struct{}, len(changed.Packages))
+	for _, pd := range changed.Packages {
+		affected[pd.Path] = struct{}{}
+	}
+
+	target, cross := p.Target()
+	if !cross {
+		target = project.Target{GOOS: goEnv("GOOS"), GOARCH: goEnv("GOARCH")}
+	}
+
+	var binaries []binary
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		pkg, err := p.Package(pd.Path)
+		if err != nil || pkg.Name != "main" {
+			continue
+		}
+		dir := p.PackageDir(pd.Path)
+		name := binaryName{
+			Name:    path.Base(pd.Path),
+			Package: pd.Path,
+			Dir:     filepath.ToSlash(dir),
+			GOOS:    target.GOOS,
+			GOARCH:  target.GOARCH,
+		}
+		if name.GOOS == "windows" {
+			name.Ext = ".exe"
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := tmpl.Execute(buf, name); err != nil {
+			return nil, fmt.Errorf("can't name binary for %s: %v", pd.Path, err)
+		}
+		status := binaryUnaffected
+		if _, ok := affected[pd.Path]; ok {
+			status = binaryAffected
+			if !p.Existed(b.base, dir) {
+				status = binaryNew
+			}
+		}
+		bin := binary{
+			Package: pd.Path,
+			Path:    filepath.Join(b.bin, filepath.FromSlash(buf.String())),
+			Status:  status,
+			p:       p,
+		}
+		if cross {
+			bin.Platform = target.Platform()
+		}
+		binaries = append(binaries, bin)
+	}
+	return binaries, nil
+}
+
+func (b *buildCmd) build(bin *binary) error {
+	args := b.buildArgs(bin, b.abs(bin.Path))
+	b.logger.Printf("Building %s.", bin.Path)
+	output, err := bin.p.Command("go", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if b.manifest {
+		return b.writeManifest(bin)
+	}
+	return nil
+}
+
+// buildArgs returns the arguments to go build for a binary, run from the root
+// of a working tree.
+func (b *buildCmd) buildArgs(bin *binary, out string) []string {
+	args := []string{"build", "-o", out}
+	if b.tags != "" {
+		args = append(args, "-tags", b.tags)
+	}
+	if b.trimpath {
+		args = append(args, "-trimpath")
+	}
+	ldflags := b.ldflags
+	if b.stampFlags != "" {
+		ldflags = strings.TrimSpace(ldflags + " " + b.stampFlags)
+	}
+	if ldflags != "" {
+		args = append(args, "-ldflags", ldflags)
+	}
+	return append(args, "./"+filepath.ToSlash(bin.p.PackageDir(bin.Package)))
+}
+
+func (b *buildCmd) writeManifest(bin *binary) error {
+	sum, err := sha256File(b.abs(bin.Path))
+	if err != nil {
+		return err
+	}
+	platform := bin.Platform
+	if platform == "" {
+		platform = goEnv("GOOS") + "/" + goEnv("GOARCH")
+	}
+	m := manifest{
+		Package:  bin.Package,
+		Platform: platform,
+		SHA256:   sum,
+		stamp:    b.stamp,
+	}
+	path := bin.Path + manifestSuffix
+	if err := writeManifest(b.abs(path), m); err != nil {
+		return fmt.Errorf("can't write manifest: %v", err)
+	}
+	bin.Manifest = path
+	return nil
+}
+
+// writeChecksums hashes the binaries that built successfully and lists them in
+// the checksums file, in the format that sha256sum -c expects.
+func (b *buildCmd) writeChecksums(binaries []binary) error {
+	dir := b.abs(b.bin)
+	var lines []string
+	for i := range binaries {
+		bin := &binaries[i]
+		if bin.Error != "" {
+			continue
+		}
+		sum, err := sha256File(b.abs(bin.Path))
+		if err != nil {
+			return err
+		}
+		bin.SHA256 = sum
+		name, err := filepath.Rel(dir, b.abs(bin.Path))
+		if err != nil {
+			name = b.abs(bin.Path)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, filepath.ToSlash(name)))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	sort.Strings(lines)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, checksumsFile), []byte(strings.Join(lines, "")), 0644)
+}
+
+// abs resolves a path relative to the repository root.
+func (b *buildCmd) abs(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(b.p.Dir(), p)
+}
+
+func (bin binary) describe() string {
+	if bin.Platform == "" {
+		return bin.Package
+	}
+	return fmt.Sprintf("%s (%s)", bin.Package, bin.Platform)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func formatBinaries(binaries []binary) string {
+	cross := false
+	for _, bin := range binaries {
+		cross = cross || bin.Platform != ""
+	}
+	buf := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	if cross {
+		fmt.Fprintln(w, "BINARY\tPACKAGE\tPLATFORM\tSTATUS")
+	} else {
+		fmt.Fprintln(w, "BINARY\tPACKAGE\tSTATUS")
+	}
+	for _, bin := range binaries {
+		status := bin.Status
+		if bin.Error != "" {
+			status = "FAILED"
+		}
+		if cross {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", bin.Path, bin.Package, bin.Platform, status)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", bin.Path, bin.Package, status)
+		}
+	}
+	w.Flush()
+	for _, bin := range binaries {
+		if bin.Error != "" {
+			fmt.Fprintf(buf, "\n%s failed to build:\n\t%s\n", bin.describe(), strings.Replace(bin.Error, "\n", "\n\t", -1))
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// goEnv returns the value of a go tool setting, falling back to the host
+// platform for GOOS and GOARCH.
+func goEnv(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	switch key {
+	case "GOOS":
+		return runtime.GOOS
+	case "GOARCH":
+		return runtime.GOARCH
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/callgraph"
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/project"
+)
+
+// sourceDiff selects packages like packageDiff, but ignores changes to test
+// files that only add or modify test functions. Those changes are covered by
+// running the changed tests instead. Changes to anything else in a test file,
+// like helpers, TestMain, or shared fixtures, affect the whole package.
+func (t *test) sourceDiff() (project.Diff, error) {
+	direct, err := t.p.Diff(t.base)
+	if err != nil {
+		return project.Diff{}, err
+	}
+	dirs := make(map[string]struct{})
+	for _, pd := range direct.Files {
+		if strings.HasSuffix(pd.Path, "_test.go") {
+			_, _, other, err := t.changedTestFuncs(pd)
+			if err != nil {
+				t.logger.Debugf("can't compare declarations in %s, so its package will be tested in full: %v", pd.Path, err)
+			} else if !other {
+				continue
+			}
+		}
+		dirs[testDataOwner(filepath.Dir(pd.Path))] = struct{}{}
+	}
+	var pkgs []project.PathDiff
+	for _, pd := range direct.Packages {
+		if _, ok := dirs[t.p.PackageDir(pd.Path)]; ok {
+			pkgs = append(pkgs, pd)
+		}
+	}
+	direct.Packages = pkgs
+	if t.direct {
+		return direct, nil
+	}
+	return t.p.Expand(direct)
+}
+
+// testDataOwner returns the directory of the package that owns a directory
+// of test data, or the directory itself if it isn't test data.
+func testDataOwner(dir string) string {
+	parts := strings.Split(filepath.ToSlash(dir), "/")
+	for i, part := range parts {
+		if part == "testdata" {
+			return filepath.FromSlash(strings.Join(parts[:i], "/"))
+		}
+	}
+	return dir
+}
+
+// addChangedTests adds the test functions added or modified since the base
+// commit to the selection. Packages already selected in full are unaffected.
+func (t *test) addChangedTests(d project.Diff) (project.Diff, error) {
+	changed := make(map[string]map[string]struct{})
+	for _, pd := range d.Files {
+		if pd.Status != project.StatusModified || !strings.HasSuffix(pd.Path, "_test.go") {
+			continue
+		}
+		pkg, names, _, err := t.changedTestFuncs(pd)
+		if err != nil {
+			return project.Diff{}, err
+		}
+		for _, name := range names {
+			if changed[pkg] == nil {
+				changed[pkg] = make(map[string]struct{})
+			}
+			changed[pkg][name] = struct{}{}
+		}
+	}
+
+	selected := make(map[string]struct{}, len(d.Packages))
+	for _, pd := range d.Packages {
+		selected[pd.Path] = struct{}{}
+	}
+	var count, pkgs int
+	for pkg, set := range changed {
+		_, inDiff := selected[pkg]
+		_, limited := t.tests[pkg]
+		if inDiff && !limited {
+			// The whole package is already being tested.
+			continue
+		}
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		t.selectTests(pkg, names)
+		count += len(names)
+		pkgs++
+		if !inDiff {
+			d.Packages = append(d.Packages, project.PathDiff{Status: project.StatusModified, Path: pkg})
+		}
+	}
+	t.logger.Printf("Selected %d added or modified tests in %d packages.", count, pkgs)
+	return d, nil
+}
+
+// changedTestFuncs returns the import path of a test file's package and the
+// test functions in the file that were added or modified since the base
+// commit. It also reports whether any other declaration changed.
+func (t *test) changedTestFuncs(pd project.PathDiff) (string, []string, bool, error) {
+	pkg, err := t.p.ImportPath(filepath.Dir(pd.Path))
+	if err != nil {
+		return "", nil, false, err
+	}
+	var current []byte
+	if pd.Status == project.StatusModified {
+		current, err = ioutil.ReadFile(filepath.Join(t.p.Dir(), pd.Path))
+		if err != nil {
+			return "", nil, false, err
+		}
+	}
+	old, err := t.p.Show(t.base, pd.Path)
+	if err != nil {
+		return "", nil, false, err
+	}
+	keys, err := callgraph.ChangedDecls(pkg, pd.Path, old, current)
+	if err != nil {
+		return "", nil, false, err
+	}
+	before, err := testFuncs(pd.Path, old)
+	if err != nil {
+		return "", nil, false, err
+	}
+	after, err := testFuncs(pd.Path, current)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	var names []string
+	other := false
+	for _, key := range keys {
+		// Keys look like "pkg.Name" or "pkg_test.Name"; methods have a
+		// receiver type too.
+		name := strings.TrimPrefix(strings.TrimPrefix(key, pkg), "_test.")
+		name = strings.TrimPrefix(name, ".")
+		switch {
+		case strings.Contains(name, "."):
+			other = true
+		case after[name]:
+			names = append(names, name)
+		case before[name]:
+			// A deleted test doesn't need to run.
+		default:
+			other = true
+		}
+	}
+	sort.Strings(names)
+	return pkg, names, other, nil
+}
+
+// testFuncs returns the names of the top-level test, benchmark, example, and
+// fuzz functions in a test file's source.
+func testFuncs(filename string, src []byte) (map[string]bool, error) {
+	funcs := make(map[string]bool)
+	if src == nil {
+		return funcs, nil
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %q: %v", filename, err)
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && discover.KindOf(f, fn) != discover.KindUnknown {
+			funcs[fn.Name.Name] = true
+		}
+	}
+	return funcs, nil
+}
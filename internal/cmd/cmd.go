@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"path/filepath"
+
 	"github.com/akshayjshah/hardhat/internal/git"
 	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
 	"github.com/akshayjshah/hardhat/internal/project"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -17,10 +20,20 @@ func New(logger *hhlog.Logger) (*kingpin.Application, error) {
 	if err != nil {
 		return nil, err
 	}
-	_ = proj
+	store := history.Open(logger, filepath.Join(repo.GitDir(), "hardhat"))
 	app := kingpin.New("hardhat", "A git-centric Go build tool.")
 	app.HelpFlag.Short('h')
 	addStatus(app, proj, logger)
-	addTest(app, proj, logger)
+	addTest(app, proj, store, logger)
+	addBuild(app, proj, logger)
+	addTimings(app, store, logger)
+	addFlakes(app, store, logger)
+	addStress(app, proj, logger)
+	addCoverageMap(app, proj, store, logger)
+	addBench(app, proj, store, logger)
+	addFuzz(app, proj, logger)
+	addVet(app, proj, store, logger)
+	addFmt(app, proj, logger)
+	addGraph(app, proj, logger)
 	return app, nil
 }
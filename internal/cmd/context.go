@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// addContextFlag registers the repeatable --context flag.
+func addContextFlag(cmd *kingpin.CmdClause, contexts *[]string) {
+	cmd.Flag("context", "Analyze the project as the go tool would build it for this GOOS/GOARCH pair, optionally followed by a colon and comma-separated build tags. Packages are affected in a context only if it builds a changed file. Repeatable.").
+		PlaceHolder("GOOS/GOARCH[:TAGS]").
+		StringsVar(contexts)
+}
+
+func parseTargets(specs []string) ([]project.Target, error) {
+	targets := make([]project.Target, 0, len(specs))
+	for _, spec := range specs {
+		t, err := project.ParseTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// contextPath adds a context's name to a file name, before the extension, so
+// that each context writes its own copy of a report.
+func contextPath(path string, t project.Target) string {
+	if path == "" {
+		return ""
+	}
+	name := t.GOOS + "-" + t.GOARCH
+	if len(t.Tags) > 0 {
+		name += "-" + strings.Join(t.Tags, "-")
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
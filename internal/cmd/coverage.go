@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/cover"
+	"github.com/akshayjshah/hardhat/internal/gotest"
+)
+
+// coverage reports whether any form of coverage analysis was requested.
+func (t *test) coverage() bool {
+	return t.cover || t.profiling()
+}
+
+// profiling reports whether the run needs to collect coverage profiles.
+func (t *test) profiling() bool {
+	return t.coverprofile != "" || t.coverHTML != "" || t.coverCobertura != "" || t.diffCoverage
+}
+
+// coverageFlags returns the go test flags that enable coverage analysis.
+func (t *test) coverageFlags(pkgs []string) []string {
+	if !t.coverage() {
+		return nil
+	}
+	flags := []string{"-cover"}
+	if t.covermode != "" {
+		flags = append(flags, "-covermode="+t.covermode)
+	}
+	switch t.coverpkg {
+	case "":
+	case "affected":
+		flags = append(flags, "-coverpkg="+strings.Join(pkgs, ","))
+	default:
+		flags = append(flags, "-coverpkg="+t.coverpkg)
+	}
+	return flags
+}
+
+// addProfiles gives each job its own coverage profile in the supplied
+// directory.
+func (t *test) addProfiles(jobs []gotest.Job, dir string) {
+	for i := range jobs {
+		profile := filepath.Join(dir, fmt.Sprintf("%d.out", i))
+		args := make([]string, 0, len(jobs[i].Args)+1)
+		args = append(args, jobs[i].Args...)
+		jobs[i].Args = append(args, "-coverprofile="+profile)
+	}
+}
+
+// mergeProfiles merges the coverage profiles in a directory and writes the
+// requested outputs.
+func (t *test) mergeProfiles(dir string) (*cover.Profile, error) {
+	profile := cover.NewProfile()
+	files, err := filepath.Glob(filepath.Join(dir, "*.out"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("can't read coverage profile: %v", err)
+		}
+		err = profile.Merge(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("can't merge coverage profile %q: %v", name, err)
+		}
+	}
+	total, covered := profile.Statements()
+	t.logger.Printf("Coverage: %.1f%% of %d statements (%d covered) in %d files.",
+		profile.Percent(), total, covered, len(profile.Files()))
+
+	merged := t.coverprofile
+	if merged == "" {
+		// The HTML report is generated from a merged profile.
+		merged = filepath.Join(dir, "merged.cov")
+	}
+	if err := writeFile(merged, profile.Write); err != nil {
+		return nil, fmt.Errorf("can't write merged coverage profile: %v", err)
+	}
+	if t.coverHTML != "" {
+		html, err := filepath.Abs(t.coverHTML)
+		if err != nil {
+			return nil, err
+		}
+		mergedAbs, err := filepath.Abs(merged)
+		if err != nil {
+			return nil, err
+		}
+		c := t.p.Command("go", "tool", "cover", "-html="+mergedAbs, "-o", html)
+		c.Stdout, c.Stderr = os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			return nil, fmt.Errorf("can't write HTML coverage report: %v", err)
+		}
+	}
+	if t.coverCobertura != "" {
+		err := writeFile(t.coverCobertura, func(w io.Writer) error {
+			return profile.WriteCobertura(w, t.p.Dir(), t.relativePath)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't write Cobertura coverage report: %v", err)
+		}
+	}
+	return profile, nil
+}
+
+// checkDiffCoverage reports the coverage of the lines changed since the base
+// commit, and fails if it's below the threshold.
+func (t *test) checkDiffCoverage(profile *cover.Profile) error {
+	changed, err := t.p.ChangedLines(t.base)
+	if err != nil {
+		return err
+	}
+	dc, err := profile.DiffCoverage(changed, t.p.Dir(), t.relativePath)
+	if err != nil {
+		return fmt.Errorf("can't measure diff coverage: %v", err)
+	}
+	if dc.Total == 0 {
+		t.logger.Printf("Diff coverage: no changed executable lines.")
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "Diff coverage: %.1f%% of %d changed executable lines (%d covered).\n",
+		dc.Percent(), dc.Total, dc.Covered)
+	var uncovered []cover.FileDiffCoverage
+	for _, fd := range dc.Files {
+		if len(fd.Uncovered) > 0 {
+			uncovered = append(uncovered, fd)
+		}
+	}
+	if len(uncovered) > 0 {
+		buf.WriteString("Uncovered changed lines:\n")
+		for _, fd := range uncovered {
+			fmt.Fprintf(buf, "\t%s:%s\n", fd.File, formatLines(fd.Uncovered))
+		}
+	}
+	t.logger.Printf("%s", strings.TrimSpace(buf.String()))
+
+	if dc.Percent() < t.diffCoverageMin {
+		return fmt.Errorf("diff coverage of %.1f%% is below the threshold of %.1f%%", dc.Percent(), t.diffCoverageMin)
+	}
+	return nil
+}
+
+// formatLines collapses sorted line numbers into ranges, like "3,7-9,12".
+func formatLines(lines []int) string {
+	var parts []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(lines[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// relativePath converts an import-path-qualified file name to a path
+// relative to the repository root.
+func (t *test) relativePath(file string) string {
+	return trimRoot(t.p.Root(), file)
+}
+
+func trimRoot(root, file string) string {
+	if rel := strings.TrimPrefix(file, root+"/"); rel != file {
+		return rel
+	}
+	return file
+}
+
+func tempDir(prefix string) (string, func(), error) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// writeFile creates or truncates a file and fills it using the supplied
+// function.
+func writeFile(name string, fill func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := fill(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
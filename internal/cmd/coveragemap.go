@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/cover"
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/gotest"
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type coverageMap struct {
+	p      *project.Project
+	store  *history.Store
+	logger *hhlog.Logger
+
+	workers int
+}
+
+func addCoverageMap(app *kingpin.Application, p *project.Project, s *history.Store, l *hhlog.Logger) {
+	c := &coverageMap{p: p, store: s, logger: l}
+	cmd := app.Command("coverage-map", "Manage the map from source lines to the tests that execute them.")
+	build := cmd.Command("build", "Run each test individually and record the lines it executes. Build the map at the commit you usually compare against.").
+		Action(c.build)
+	build.Flag("workers", "Number of concurrent go test invocations.").
+		Short('p').
+		Default(strconv.Itoa(runtime.NumCPU())).
+		IntVar(&c.workers)
+}
+
+func (c *coverageMap) build(_ *kingpin.ParseContext) error {
+	// The map is stored for HEAD, so the tests must run against it.
+	dirty, err := c.p.Dirty()
+	if err != nil {
+		return c.logger.Annotate(err)
+	}
+	if dirty {
+		return c.logger.Annotate(errors.New("can't map coverage with uncommitted changes, since the map would describe HEAD"))
+	}
+	commit, err := c.p.Canonicalize("HEAD")
+	if err != nil {
+		return c.logger.Annotate(err)
+	}
+	tests, err := c.tests()
+	if err != nil {
+		return c.logger.Annotate(err)
+	}
+	if len(tests) == 0 {
+		c.logger.Printf("No tests to map.")
+		return nil
+	}
+	dir, cleanup, err := tempDir("hardhat-coverage-map")
+	if err != nil {
+		return c.logger.Annotate(err)
+	}
+	defer cleanup()
+
+	// Instrument every package in the project, so that each test's coverage
+	// includes the code it reaches in other packages.
+	coverpkg := "-coverpkg=" + c.p.Root() + "/..."
+	jobs := make([]gotest.Job, len(tests))
+	for i, id := range tests {
+		jobs[i] = gotest.Job{
+			Packages: []string{id.Package},
+			Args: []string{
+				"-count=1",
+				"-run", "^" + regexp.QuoteMeta(id.Test) + "$",
+				coverpkg,
+				"-coverprofile=" + filepath.Join(dir, fmt.Sprintf("%d.out", i)),
+			},
+		}
+	}
+	c.logger.Printf("Running %d tests individually to map their coverage.", len(tests))
+	runner := &gotest.Runner{
+		Command: func(args ...string) *exec.Cmd {
+			return c.p.Command("go", args...)
+		},
+		Args:    []string{"-covermode=set"},
+		Workers: c.workers,
+		Out:     ioutil.Discard,
+	}
+	report, err := runner.Run(jobs)
+	if err != nil {
+		// Failing tests still write coverage profiles, so the map is still
+		// useful.
+		c.logger.Printf("Some tests failed, so their coverage may be incomplete: %v", err)
+	}
+
+	m := history.NewCoverageMap(commit, time.Now())
+	filename := func(file string) string {
+		return trimRoot(c.p.Root(), file)
+	}
+	for i, id := range tests {
+		profile, err := readProfile(filepath.Join(dir, fmt.Sprintf("%d.out", i)))
+		if err != nil {
+			c.logger.Debugf("no coverage for %s %s: %v", id.Package, id.Test, err)
+			continue
+		}
+		m.Add(id, profile, filename)
+	}
+	if err := c.store.SaveCoverageMap(m); err != nil {
+		return c.logger.Annotate(err)
+	}
+	c.logger.Printf("Mapped the coverage of %d tests in %d packages across %d files at %s.",
+		len(m.Tests), len(report.Packages), len(m.Files), commit)
+	return nil
+}
+
+// tests finds every top-level test in the project.
+func (c *coverageMap) tests() ([]history.TestID, error) {
+	d, err := c.p.All()
+	if err != nil {
+		return nil, err
+	}
+	var tests []history.TestID
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(c.p.Dir(), c.p.PackageDir(pd.Path), "*_test.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			funcs, err := discover.File(file)
+			if err != nil {
+				return nil, err
+			}
+			for _, fn := range funcs {
+				if fn.Kind == discover.KindTest {
+					tests = append(tests, history.TestID{Package: pd.Path, Test: fn.Name})
+				}
+			}
+		}
+	}
+	return tests, nil
+}
+
+func readProfile(name string) (*cover.Profile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profile := cover.NewProfile()
+	if err := profile.Merge(f); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
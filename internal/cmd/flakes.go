@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type flakes struct {
+	store  *history.Store
+	logger *hhlog.Logger
+
+	limit int
+	since time.Duration
+	json  bool
+}
+
+func addFlakes(app *kingpin.Application, s *history.Store, l *hhlog.Logger) {
+	f := &flakes{store: s, logger: l}
+	cmd := app.Command("flakes", "List the flakiest tests.").Action(f.run)
+	cmd.Flag("limit", "Maximum number of tests to list.").
+		Short('n').
+		Default("20").
+		IntVar(&f.limit)
+	cmd.Flag("since", "Only count flakes seen within this long.").
+		DurationVar(&f.since)
+	cmd.Flag("json", "Format output as JSON.").
+		BoolVar(&f.json)
+}
+
+func (f *flakes) run(_ *kingpin.ParseContext) error {
+	stored, err := f.store.Flakes()
+	if err != nil {
+		return f.logger.Annotate(err)
+	}
+	flakiest := f.filter(stored.Flakiest())
+	if f.json {
+		bs, err := json.Marshal(flakiest)
+		if err != nil {
+			return f.logger.Annotate(err)
+		}
+		f.logger.Printf("%s", bs)
+		return nil
+	}
+	f.logger.Printf("%s", f.format(flakiest))
+	return nil
+}
+
+// filter keeps the flakes seen within the --since window, ordered by how
+// often they flaked within it, and then applies the --limit.
+func (f *flakes) filter(all []*history.Flake) []*history.Flake {
+	kept := all
+	if f.since > 0 {
+		cutoff := time.Now().Add(-f.since)
+		counts := make(map[*history.Flake]int, len(all))
+		kept = nil
+		for _, flake := range all {
+			if n := flake.Since(cutoff); n > 0 {
+				counts[flake] = n
+				kept = append(kept, flake)
+			}
+		}
+		// Stable, so ties stay ordered by all-time count and recency.
+		sort.SliceStable(kept, func(i, j int) bool {
+			return counts[kept[i]] > counts[kept[j]]
+		})
+	}
+	if f.limit > 0 && len(kept) > f.limit {
+		kept = kept[:f.limit]
+	}
+	return kept
+}
+
+func (f *flakes) format(flakiest []*history.Flake) string {
+	if len(flakiest) == 0 {
+		return "No flaky tests recorded."
+	}
+	buf := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tTEST\tFLAKES\tLAST SEEN")
+	for _, flake := range flakiest {
+		count := flake.Count
+		if f.since > 0 {
+			count = flake.Since(time.Now().Add(-f.since))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+			flake.Package,
+			flake.Test,
+			count,
+			flake.LastSeen.Format("2006-01-02 15:04"),
+		)
+	}
+	w.Flush()
+	return strings.TrimSpace(buf.String())
+}
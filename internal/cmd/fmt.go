@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/format"
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type fmtCmd struct {
+	p      *project.Project
+	logger *hhlog.Logger
+
+	all   bool
+	base  string
+	fix   bool
+	local string
+}
+
+func addFmt(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
+	f := &fmtCmd{p: p, logger: l}
+	cmd := app.Command("fmt", "Check the formatting of modified Go files, or fix it.").Action(f.run)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&f.base)
+	cmd.Flag("all", "Check all Go files.").
+		Short('a').
+		BoolVar(&f.all)
+	cmd.Flag("fix", "Rewrite files instead of printing diffs.").
+		Short('w').
+		BoolVar(&f.fix)
+	cmd.Flag("local", "Put imports beginning with these comma-separated prefixes in their own group, after third-party imports.").
+		PlaceHolder("PREFIXES").
+		StringVar(&f.local)
+}
+
+func (f *fmtCmd) run(_ *kingpin.ParseContext) error {
+	files, err := f.files()
+	if err != nil {
+		return f.logger.Annotate(err)
+	}
+	if len(files) == 0 {
+		f.logger.Printf("No Go files to format.")
+		return nil
+	}
+	var local []string
+	if f.local != "" {
+		local = strings.Split(f.local, ",")
+	}
+
+	var unformatted []string
+	for _, file := range files {
+		path := filepath.Join(f.p.Dir(), file)
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return f.logger.Annotate(err)
+		}
+		if format.IsGenerated(src) {
+			f.logger.Debugf("skipping generated file %s", file)
+			continue
+		}
+		formatted, err := f.format(file, src, local)
+		if err != nil {
+			return f.logger.Annotate(fmt.Errorf("can't format %s: %v", file, err))
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+		unformatted = append(unformatted, file)
+		if f.fix {
+			info, err := os.Stat(path)
+			if err != nil {
+				return f.logger.Annotate(err)
+			}
+			if err := ioutil.WriteFile(path, formatted, info.Mode()); err != nil {
+				return f.logger.Annotate(err)
+			}
+			f.logger.Printf("Formatted %s.", file)
+			continue
+		}
+		diff := format.Diff(filepath.ToSlash(file), src, formatted)
+		f.logger.Printf("%s", strings.TrimRight(diff, "\n"))
+	}
+	if len(unformatted) == 0 {
+		f.logger.Printf("All %d files are formatted.", len(files))
+		return nil
+	}
+	if !f.fix {
+		return f.logger.Annotate(fmt.Errorf("%d files aren't formatted; run hardhat fmt --fix", len(unformatted)))
+	}
+	return nil
+}
+
+// files returns the modified Go files, relative to the repository root.
+// Vendored code and test data are skipped.
+func (f *fmtCmd) files() ([]string, error) {
+	var d project.Diff
+	var err error
+	if f.all {
+		d, err = f.p.All()
+	} else {
+		d, err = f.p.Diff(f.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, pd := range d.Files {
+		if pd.Status != project.StatusModified || !strings.HasSuffix(pd.Path, ".go") {
+			continue
+		}
+		skip := false
+		for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(pd.Path)), "/") {
+			skip = skip || dir == "vendor" || dir == "testdata"
+		}
+		if !skip {
+			files = append(files, pd.Path)
+		}
+	}
+	return files, nil
+}
+
+// format groups a file's imports and then runs gofmt -s on it.
+func (f *fmtCmd) format(file string, src []byte, local []string) ([]byte, error) {
+	grouped, err := format.GroupImports(file, src, local)
+	if err != nil {
+		return nil, err
+	}
+	out, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	c := f.p.Command("gofmt", "-s")
+	c.Stdin = bytes.NewReader(grouped)
+	c.Stdout, c.Stderr = out, stderr
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Bytes(), nil
+}
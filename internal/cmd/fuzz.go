@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Show this many lines of output from a failed fuzz run.
+const fuzzOutputLines = 20
+
+type fuzz struct {
+	p      *project.Project
+	logger *hhlog.Logger
+
+	all      bool
+	direct   bool
+	base     string
+	pattern  string
+	fuzztime time.Duration
+	parallel int
+}
+
+// A fuzzTarget is a single fuzz function and the outcome of fuzzing it.
+type fuzzTarget struct {
+	pkg  string
+	name string
+
+	failed   bool
+	crashers []string // new files in testdata/fuzz, relative to the repository root
+	output   string
+}
+
+func addFuzz(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
+	f := &fuzz{p: p, logger: l}
+	cmd := app.Command("fuzz", "Fuzz the fuzz targets in affected packages.").Action(f.run)
+	cmd.Flag("direct", "Include only directly modified packages.").
+		Short('d').
+		BoolVar(&f.direct)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&f.base)
+	cmd.Flag("all", "Fuzz targets in all packages.").
+		Short('a').
+		BoolVar(&f.all)
+	cmd.Flag("fuzz", "Fuzz only targets matching a regexp.").
+		Default(".").
+		StringVar(&f.pattern)
+	cmd.Flag("fuzztime", "Time to spend fuzzing each target.").
+		Default("30s").
+		DurationVar(&f.fuzztime)
+	cmd.Flag("parallel", "Number of fuzzing processes for each target. Defaults to GOMAXPROCS.").
+		IntVar(&f.parallel)
+}
+
+func (f *fuzz) run(_ *kingpin.ParseContext) error {
+	re, err := regexp.Compile(f.pattern)
+	if err != nil {
+		return f.logger.Annotate(err)
+	}
+	targets, err := f.targets(re)
+	if err != nil {
+		return f.logger.Annotate(err)
+	}
+	if len(targets) == 0 {
+		f.logger.Printf("No affected packages have fuzz targets.")
+		return nil
+	}
+	f.logger.Printf("Fuzzing %d targets for %v each.", len(targets), f.fuzztime)
+	for _, tg := range targets {
+		if err := f.invoke(tg); err != nil {
+			return f.logger.Annotate(err)
+		}
+	}
+	f.logger.Printf("%s", f.format(targets))
+	for _, tg := range targets {
+		if tg.failed {
+			return f.logger.Annotate(fmt.Errorf("fuzzing found failures"))
+		}
+	}
+	return nil
+}
+
+// targets discovers the fuzz functions in the affected packages.
+func (f *fuzz) targets(re *regexp.Regexp) ([]*fuzzTarget, error) {
+	var d project.Diff
+	var err error
+	if f.all {
+		d, err = f.p.All()
+	} else if f.direct {
+		d, err = f.p.Diff(f.base)
+	} else {
+		d, err = f.p.RecursiveDiff(f.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var targets []*fuzzTarget
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(f.p.Dir(), f.p.PackageDir(pd.Path), "*_test.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			funcs, err := discover.File(file)
+			if err != nil {
+				return nil, err
+			}
+			for _, fn := range funcs {
+				if fn.Kind == discover.KindFuzz && re.MatchString(fn.Name) {
+					targets = append(targets, &fuzzTarget{pkg: pd.Path, name: fn.Name})
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+// invoke fuzzes a single target. The go tool saves failing inputs to the
+// package's testdata/fuzz directory, where they become regression tests.
+func (f *fuzz) invoke(tg *fuzzTarget) error {
+	corpus := filepath.Join(f.p.PackageDir(tg.pkg), "testdata", "fuzz", tg.name)
+	before := corpusFiles(filepath.Join(f.p.Dir(), corpus))
+
+	args := []string{
+		"test",
+		"-run=^$",
+		"-fuzz=^" + regexp.QuoteMeta(tg.name) + "$",
+		"-fuzztime=" + f.fuzztime.String(),
+	}
+	if f.parallel > 0 {
+		args = append(args, fmt.Sprintf("-parallel=%d", f.parallel))
+	}
+	args = append(args, "./"+filepath.ToSlash(f.p.PackageDir(tg.pkg)))
+	f.logger.Printf("Fuzzing %s in %s.", tg.name, tg.pkg)
+	out, err := f.p.Command("go", args...).CombinedOutput()
+	if err != nil {
+		tg.failed = true
+		tg.output = tail(string(out), fuzzOutputLines)
+	}
+
+	for name := range corpusFiles(filepath.Join(f.p.Dir(), corpus)) {
+		if _, ok := before[name]; !ok {
+			tg.crashers = append(tg.crashers, filepath.Join(corpus, name))
+		}
+	}
+	if tg.failed && len(tg.crashers) == 0 && strings.Contains(string(out), "flag provided but not defined: -fuzz") {
+		return fmt.Errorf("the installed go tool doesn't support fuzzing")
+	}
+	return nil
+}
+
+func (f *fuzz) format(targets []*fuzzTarget) string {
+	buf := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tTARGET\tRESULT\tNEW CRASHERS")
+	failures := 0
+	for _, tg := range targets {
+		result := "ok"
+		if tg.failed {
+			result = "FAIL"
+			failures++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", tg.pkg, tg.name, result, len(tg.crashers))
+	}
+	w.Flush()
+
+	if failures == 0 {
+		buf.WriteString("\nNo failures.")
+		return strings.TrimSpace(buf.String())
+	}
+	for _, tg := range targets {
+		if !tg.failed {
+			continue
+		}
+		fmt.Fprintf(buf, "\n%s in %s failed:\n", tg.name, tg.pkg)
+		for _, c := range tg.crashers {
+			fmt.Fprintf(buf, "\tsaved %s\n", c)
+		}
+		for _, line := range strings.Split(tg.output, "\n") {
+			fmt.Fprintf(buf, "\t| %s\n", line)
+		}
+	}
+	buf.WriteString("\nCommit the saved inputs to keep them as regression tests.")
+	return strings.TrimSpace(buf.String())
+}
+
+func corpusFiles(dir string) map[string]struct{} {
+	files := make(map[string]struct{})
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			files[info.Name()] = struct{}{}
+		}
+	}
+	return files
+}
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// With --highlight, packages are modified, affected by a modification, or
+// neither.
+const (
+	nodeModified = "modified"
+	nodeAffected = "affected"
+)
+
+var nodeColors = map[string]string{
+	nodeModified: "#f4a6a6",
+	nodeAffected: "#fde2a7",
+}
+
+type graphCmd struct {
+	p      *project.Project
+	logger *hhlog.Logger
+
+	format    string
+	highlight bool
+	base      string
+	focus     string
+	depth     int
+	collapse  int
+	noTests   bool
+}
+
+// A graphNode is a package, or a group of packages, in the exported graph.
+type graphNode struct {
+	Package string `json:"package"`
+	Status  string `json:"status,omitempty"`
+}
+
+type graphJSON struct {
+	Packages []graphNode    `json:"packages"`
+	Edges    []project.Edge `json:"edges"`
+}
+
+func addGraph(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
+	g := &graphCmd{p: p, logger: l}
+	cmd := app.Command("graph", "Export the import graph of the project's packages.").Action(g.run)
+	cmd.Flag("format", "Output format.").
+		Default("dot").
+		EnumVar(&g.format, "dot", "json", "mermaid")
+	cmd.Flag("highlight", "Highlight the packages modified since the base commit, and the packages they affect.").
+		BoolVar(&g.highlight)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&g.base)
+	cmd.Flag("focus", "Include only packages connected to this package, given as an import path or a directory like ./internal/cmd.").
+		PlaceHolder("PACKAGE").
+		StringVar(&g.focus)
+	cmd.Flag("depth", "With --focus, include only packages within this many imports of it.").
+		IntVar(&g.depth)
+	cmd.Flag("collapse", "Merge packages that share this many leading directories.").
+		PlaceHolder("N").
+		IntVar(&g.collapse)
+	cmd.Flag("no-tests", "Exclude imports used only by tests.").
+		BoolVar(&g.noTests)
+}
+
+func (g *graphCmd) run(_ *kingpin.ParseContext) error {
+	graph, err := g.p.Graph()
+	if err != nil {
+		return g.logger.Annotate(err)
+	}
+	if g.noTests {
+		graph = graph.WithoutTests()
+	}
+	if g.focus != "" {
+		focus, err := g.focusPackage()
+		if err != nil {
+			return g.logger.Annotate(err)
+		}
+		found := false
+		for _, pkg := range graph.Packages {
+			found = found || pkg == focus
+		}
+		if !found {
+			return g.logger.Annotate(fmt.Errorf("package %q isn't part of the project", focus))
+		}
+		graph = graph.Around(focus, g.depth)
+	}
+	status := make(map[string]string)
+	if g.highlight {
+		d, err := g.p.RecursiveDiff(g.base)
+		if err != nil {
+			return g.logger.Annotate(err)
+		}
+		for _, pd := range d.Packages {
+			if pd.Status != project.StatusModified {
+				continue
+			}
+			status[pd.Path] = nodeAffected
+			if pd.Distance == 0 {
+				status[pd.Path] = nodeModified
+			}
+		}
+	}
+	if g.collapse > 0 {
+		collapsed := make(map[string]string)
+		for pkg, s := range status {
+			name := g.collapseName(pkg)
+			if collapsed[name] != nodeModified {
+				collapsed[name] = s
+			}
+		}
+		status = collapsed
+		graph = graph.Collapse(g.collapseName)
+	}
+
+	nodes := make([]graphNode, len(graph.Packages))
+	for i, pkg := range graph.Packages {
+		nodes[i] = graphNode{Package: pkg, Status: status[pkg]}
+	}
+	var out string
+	switch g.format {
+	case "json":
+		bs, err := json.Marshal(graphJSON{Packages: nodes, Edges: graph.Edges})
+		if err != nil {
+			return g.logger.Annotate(err)
+		}
+		out = string(bs)
+	case "mermaid":
+		out = g.mermaid(nodes, graph.Edges)
+	default:
+		out = g.dot(nodes, graph.Edges)
+	}
+	g.logger.Printf("%s", out)
+	return nil
+}
+
+// focusPackage resolves --focus to an import path.
+func (g *graphCmd) focusPackage() (string, error) {
+	if !strings.HasPrefix(g.focus, ".") {
+		return g.focus, nil
+	}
+	dir, err := filepath.Abs(g.focus)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(g.p.Dir(), dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("can't find package %q: %v", g.focus, err)
+	}
+	return g.p.ImportPath(rel)
+}
+
+// collapseName truncates a package's path within the project to the
+// --collapse depth.
+func (g *graphCmd) collapseName(pkg string) string {
+	rel := strings.TrimPrefix(pkg, g.p.Root()+"/")
+	if rel == pkg {
+		return pkg
+	}
+	parts := strings.Split(rel, "/")
+	if len(parts) <= g.collapse {
+		return pkg
+	}
+	return g.p.Root() + "/" + strings.Join(parts[:g.collapse], "/") + "/..."
+}
+
+// label shortens an import path to its directory within the project.
+func (g *graphCmd) label(pkg string) string {
+	if pkg == g.p.Root() {
+		return "."
+	}
+	return strings.TrimPrefix(pkg, g.p.Root()+"/")
+}
+
+func (g *graphCmd) dot(nodes []graphNode, edges []project.Edge) string {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("digraph imports {\n")
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box];\n")
+	for _, n := range nodes {
+		attrs := fmt.Sprintf("label=%q", g.label(n.Package))
+		if color, ok := nodeColors[n.Status]; ok {
+			attrs += fmt.Sprintf(", style=filled, fillcolor=%q", color)
+		}
+		fmt.Fprintf(buf, "\t%q [%s];\n", n.Package, attrs)
+	}
+	for _, e := range edges {
+		if e.Test {
+			fmt.Fprintf(buf, "\t%q -> %q [style=dashed];\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(buf, "\t%q -> %q;\n", e.From, e.To)
+		}
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+func (g *graphCmd) mermaid(nodes []graphNode, edges []project.Edge) string {
+	ids := make(map[string]string, len(nodes))
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("graph LR\n")
+	for i, n := range nodes {
+		ids[n.Package] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(buf, "\t%s[\"%s\"]\n", ids[n.Package], strings.Replace(g.label(n.Package), `"`, "#quot;", -1))
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if e.Test {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(buf, "\t%s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+	for _, s := range []string{nodeModified, nodeAffected} {
+		var members []string
+		for _, n := range nodes {
+			if n.Status == s {
+				members = append(members, ids[n.Package])
+			}
+		}
+		if len(members) > 0 {
+			fmt.Fprintf(buf, "\tclassDef %s fill:%s;\n", s, nodeColors[s])
+			fmt.Fprintf(buf, "\tclass %s %s;\n", strings.Join(members, ","), s)
+		}
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
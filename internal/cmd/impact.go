@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/callgraph"
+	"github.com/akshayjshah/hardhat/internal/project"
+)
+
+// selectByCoverage uses the coverage map to select only the tests that
+// executed the lines changed since the base commit. Changes the map can't
+// account for, like new code, test files, and non-Go files, fall back to
+// testing whole packages.
+func (t *test) selectByCoverage() (project.Diff, error) {
+	m, err := t.store.CoverageMap()
+	if err != nil {
+		return project.Diff{}, err
+	}
+	if m == nil {
+		t.logger.Printf(`No coverage map has been built, so tests will be selected by package. Run "hardhat coverage-map build" to build one.`)
+		return t.packageDiff()
+	}
+	if base, err := t.p.Canonicalize(t.base); err == nil && base != m.Commit {
+		t.logger.Printf("The coverage map was built at %s rather than %s, so some tests may be missed.", short(m.Commit), t.base)
+	}
+
+	direct, err := t.p.Diff(t.base)
+	if err != nil {
+		return project.Diff{}, err
+	}
+	// The map's line numbers are from the base commit, so look up the base
+	// side of each change.
+	changed, err := t.p.Hunks(t.base)
+	if err != nil {
+		return project.Diff{}, err
+	}
+
+	tests := make(map[string]map[string]struct{})
+	// Changes to a package's tests or test data can only affect that package,
+	// but other unmapped changes also affect its importers.
+	expand := make(map[string]struct{})
+	local := make(map[string]struct{})
+	for _, pd := range direct.Files {
+		hunks := changed[pd.Path]
+		if pd.Status == project.StatusModified && isSource(pd.Path) && len(hunks) > 0 {
+			if ids, ok := m.Lookup(filepath.ToSlash(pd.Path), hunks); ok {
+				for _, id := range ids {
+					if tests[id.Package] == nil {
+						tests[id.Package] = make(map[string]struct{})
+					}
+					tests[id.Package][id.Test] = struct{}{}
+				}
+				continue
+			}
+		}
+		t.logger.Debugf("coverage map doesn't cover changes to %s, so its package will be tested", pd.Path)
+		dir := filepath.Dir(pd.Path)
+		if filepath.Base(dir) == "testdata" {
+			local[filepath.Dir(dir)] = struct{}{}
+		} else if strings.HasSuffix(pd.Path, "_test.go") {
+			local[dir] = struct{}{}
+		} else {
+			expand[dir] = struct{}{}
+		}
+	}
+
+	d := project.Diff{Files: direct.Files}
+	var localPkgs []project.PathDiff
+	for _, pd := range direct.Packages {
+		dir := t.p.PackageDir(pd.Path)
+		if _, ok := expand[dir]; ok {
+			d.Packages = append(d.Packages, pd)
+		} else if _, ok := local[dir]; ok {
+			localPkgs = append(localPkgs, pd)
+		}
+	}
+	if !t.direct {
+		d, err = t.p.Expand(d)
+		if err != nil {
+			return project.Diff{}, err
+		}
+	}
+	full := make(map[string]struct{}, len(d.Packages))
+	for _, pd := range d.Packages {
+		full[pd.Path] = struct{}{}
+	}
+	for _, pd := range localPkgs {
+		if _, ok := full[pd.Path]; !ok {
+			full[pd.Path] = struct{}{}
+			d.Packages = append(d.Packages, pd)
+		}
+	}
+
+	var selected, pkgs int
+	for pkg, set := range tests {
+		if _, ok := full[pkg]; ok {
+			continue
+		}
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		t.selectTests(pkg, names)
+		selected += len(names)
+		pkgs++
+		d.Packages = append(d.Packages, project.PathDiff{Status: project.StatusModified, Path: pkg})
+	}
+	t.logger.Printf("Coverage map selected %d tests in %d packages; %d packages will be tested in full.",
+		selected, pkgs, len(full))
+	return d, nil
+}
+
+// isSource reports whether a file is non-test Go source, which is the only
+// kind of file the coverage map covers.
+func isSource(path string) bool {
+	return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go")
+}
+
+func short(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// selectByCallGraph selects only the tests that can reach the declarations
+// changed since the base commit, according to a call graph of the affected
+// packages. Changes that aren't to Go declarations, like edits to test data,
+// fall back to testing the whole package.
+func (t *test) selectByCallGraph() (project.Diff, error) {
+	d, err := t.packageDiff()
+	if err != nil {
+		return project.Diff{}, err
+	}
+
+	full := make(map[string]struct{})
+	g := callgraph.New()
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		if err := t.addToGraph(g, pd.Path); err != nil {
+			t.logger.Debugf("can't analyze %s, so it will be tested in full: %v", pd.Path, err)
+			full[pd.Path] = struct{}{}
+		}
+	}
+
+	var changed []string
+	for _, pd := range d.Files {
+		keys, err := t.changedDecls(pd)
+		if err == nil {
+			changed = append(changed, keys...)
+			continue
+		}
+		t.logger.Debugf("can't compare declarations in %s, so its package will be tested in full: %v", pd.Path, err)
+		dir := filepath.Dir(pd.Path)
+		if filepath.Base(dir) == "testdata" {
+			dir = filepath.Dir(dir)
+		}
+		if pkg, err := t.p.ImportPath(dir); err == nil {
+			full[pkg] = struct{}{}
+		}
+	}
+	t.logger.Debugf("changed declarations: %v", changed)
+
+	sel := g.Select(changed)
+	for _, pkg := range sel.Packages {
+		full[pkg] = struct{}{}
+	}
+	selected := project.Diff{Files: d.Files}
+	var tests, pkgs int
+	for _, pd := range d.Packages {
+		if _, ok := full[pd.Path]; ok || pd.Status != project.StatusModified {
+			selected.Packages = append(selected.Packages, pd)
+			continue
+		}
+		names := sel.Tests[pd.Path]
+		if len(names) == 0 {
+			continue
+		}
+		t.selectTests(pd.Path, names)
+		tests += len(names)
+		pkgs++
+		selected.Packages = append(selected.Packages, pd)
+	}
+	t.logger.Printf("Call graph selected %d tests in %d packages; %d packages will be tested in full.",
+		tests, pkgs, len(full))
+	return selected, nil
+}
+
+// addToGraph adds a package's source and test files to the call graph.
+func (t *test) addToGraph(g *callgraph.Graph, importPath string) error {
+	pkg, err := t.p.Package(importPath)
+	if err != nil {
+		return err
+	}
+	var files []string
+	files = append(files, pkg.GoFiles...)
+	files = append(files, pkg.CgoFiles...)
+	files = append(files, pkg.TestGoFiles...)
+	files = append(files, pkg.XTestGoFiles...)
+	for _, name := range files {
+		path := filepath.Join(pkg.Dir, name)
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := g.AddFile(importPath, path, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedDecls compares a modified Go file to its state at the base commit.
+// It returns an error for any change it can't describe.
+func (t *test) changedDecls(pd project.PathDiff) ([]string, error) {
+	if !strings.HasSuffix(pd.Path, ".go") {
+		return nil, errors.New("not a Go file")
+	}
+	pkg, err := t.p.ImportPath(filepath.Dir(pd.Path))
+	if err != nil {
+		return nil, err
+	}
+	old, err := t.p.Show(t.base, pd.Path)
+	if err != nil {
+		return nil, err
+	}
+	var current []byte
+	if pd.Status == project.StatusModified {
+		current, err = ioutil.ReadFile(filepath.Join(t.p.Dir(), pd.Path))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return callgraph.ChangedDecls(pkg, pd.Path, old, current)
+}
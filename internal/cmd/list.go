@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/project"
+)
+
+// A packageFuncs lists the test functions in a single package.
+type packageFuncs struct {
+	Package string          `json:"package"`
+	Funcs   []discover.Func `json:"funcs"`
+}
+
+// listTests parses the test files in the selected packages and prints the
+// test functions whose names match the --list regexp, without compiling
+// anything.
+func (t *test) listTests(d project.Diff) error {
+	re, err := regexp.Compile(t.list)
+	if err != nil {
+		return err
+	}
+	var listed []packageFuncs
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		funcs, err := t.testFuncs(pd.Path)
+		if err != nil {
+			return err
+		}
+		var only *regexp.Regexp
+		if names, ok := t.tests[pd.Path]; ok {
+			only = regexp.MustCompile(runPattern(names))
+		}
+		pf := packageFuncs{Package: pd.Path}
+		for _, fn := range funcs {
+			if re.MatchString(fn.Name) && (only == nil || only.MatchString(fn.Name)) {
+				pf.Funcs = append(pf.Funcs, fn)
+			}
+		}
+		if len(pf.Funcs) > 0 {
+			listed = append(listed, pf)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].Package < listed[j].Package
+	})
+
+	if t.listFormat == "json" {
+		bs, err := json.Marshal(listed)
+		if err != nil {
+			return err
+		}
+		t.logger.Printf("%s", bs)
+		return nil
+	}
+	if len(listed) == 0 {
+		t.logger.Printf("No matching tests.")
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	for i, pf := range listed {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "%s\n", pf.Package)
+		w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+		writeFuncs(w, pf.Funcs)
+		w.Flush()
+	}
+	t.logger.Printf("%s", strings.TrimSpace(buf.String()))
+	return nil
+}
+
+func writeFuncs(w *tabwriter.Writer, funcs []discover.Func) {
+	for _, fn := range funcs {
+		fmt.Fprintf(w, "\t%s:%d\t%s\t%s\n", fn.File, fn.Line, fn.Kind, fn.Name)
+		writeFuncs(w, fn.Subtests)
+	}
+}
+
+// testFuncs parses the test files that the go tool would compile for a
+// package, with file names relative to the repository root.
+func (t *test) testFuncs(importPath string) ([]discover.Func, error) {
+	pkg, err := t.p.Package(importPath)
+	if err != nil {
+		return nil, err
+	}
+	var funcs []discover.Func
+	for _, name := range append(pkg.TestGoFiles, pkg.XTestGoFiles...) {
+		path := filepath.Join(t.p.PackageDir(importPath), name)
+		fs, err := discover.File(filepath.Join(t.p.Dir(), path))
+		if err != nil {
+			return nil, err
+		}
+		for i := range fs {
+			relativize(&fs[i], path)
+		}
+		funcs = append(funcs, fs...)
+	}
+	return funcs, nil
+}
+
+func relativize(fn *discover.Func, path string) {
+	fn.File = path
+	for i := range fn.Subtests {
+		relativize(&fn.Subtests[i], path)
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Show the packages that grew the most in each binary, up to this many.
+const sizePackages = 10
+
+// A binarySize compares the size of a binary to its size at the merge base.
+type binarySize struct {
+	// Old is zero if the binary didn't exist at the merge base.
+	Old     int64   `json:"old"`
+	New     int64   `json:"new"`
+	Delta   int64   `json:"delta"`
+	Percent float64 `json:"percent"`
+	// Packages lists the packages whose symbols changed size, with the
+	// largest growth first.
+	Packages []packageSize `json:"packages,omitempty"`
+}
+
+// A packageSize is the total size of a package's symbols in a binary.
+type packageSize struct {
+	Package string `json:"package"`
+	Old     int64  `json:"old"`
+	New     int64  `json:"new"`
+	Delta   int64  `json:"delta"`
+}
+
+// compareSizes builds each binary at the merge base and compares the sizes of
+// the two builds. It returns the number of binaries that grew by more than
+// the size threshold and the number that couldn't be compared.
+func (b *buildCmd) compareSizes(binaries []binary) (int, int, error) {
+	mergeBase, err := b.p.MergeBase(b.base)
+	if err != nil {
+		return 0, 0, err
+	}
+	tree, env, removeWorktree, err := b.p.Worktree(mergeBase)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer removeWorktree()
+	dir, cleanup, err := tempDir("hardhat-size")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cleanup()
+
+	outputs := make(map[*binary]string, len(binaries))
+	for i := range binaries {
+		outputs[&binaries[i]] = filepath.Join(dir, strconv.Itoa(i))
+	}
+	b.logger.Printf("Building binaries at %s to compare sizes.", short(mergeBase))
+	b.parallel(binaries, func(bin *binary) error {
+		if bin.Error != "" {
+			return nil
+		}
+		size, err := b.size(bin, mergeBase, tree, env, outputs[bin])
+		if err != nil {
+			b.logger.Printf("Couldn't compare the size of %s: %v", bin.Path, err)
+			return nil
+		}
+		bin.Size = size
+		return nil
+	})
+
+	grown, failed := 0, 0
+	for _, bin := range binaries {
+		if bin.Error != "" {
+			continue
+		}
+		if bin.Size == nil {
+			failed++
+		} else if b.sizeThreshold > 0 && bin.Size.Old > 0 && bin.Size.Percent > b.sizeThreshold {
+			grown++
+		}
+	}
+	return grown, failed, nil
+}
+
+// size builds a binary in the merge base's working tree and compares it to
+// the binary built at HEAD. If either binary has no symbol table, as when
+// it's built with -ldflags=-s, only the file sizes are compared.
+func (b *buildCmd) size(bin *binary, mergeBase, tree string, env []string, out string) (*binarySize, error) {
+	head := b.abs(bin.Path)
+	info, err := os.Stat(head)
+	if err != nil {
+		return nil, err
+	}
+	symbols := true
+	newSyms, err := b.symbolSizes(head)
+	if err != nil {
+		b.logger.Debugf("comparing only the file size of %s: %v", bin.Path, err)
+		symbols = false
+	}
+	size := &binarySize{New: info.Size()}
+	oldSyms := make(map[string]int64)
+	if bin.p.Existed(mergeBase, bin.p.PackageDir(bin.Package)) {
+		c := exec.Command("go", b.buildArgs(bin, out)...)
+		c.Dir = tree
+		c.Env = bin.p.Environ(env)
+		if output, err := c.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("can't build at %s: %v: %s", short(mergeBase), err, strings.TrimSpace(string(output)))
+		}
+		info, err := os.Stat(out)
+		if err != nil {
+			return nil, err
+		}
+		size.Old = info.Size()
+		if symbols {
+			if oldSyms, err = b.symbolSizes(out); err != nil {
+				b.logger.Debugf("comparing only the file size of %s: %v", bin.Path, err)
+				symbols = false
+			}
+		}
+	}
+	size.Delta = size.New - size.Old
+	if size.Old > 0 {
+		size.Percent = 100 * float64(size.Delta) / float64(size.Old)
+	}
+	if !symbols {
+		return size, nil
+	}
+
+	for pkg, n := range newSyms {
+		if n != oldSyms[pkg] {
+			size.Packages = append(size.Packages, packageSize{Package: pkg, Old: oldSyms[pkg], New: n, Delta: n - oldSyms[pkg]})
+		}
+	}
+	for pkg, n := range oldSyms {
+		if _, ok := newSyms[pkg]; !ok {
+			size.Packages = append(size.Packages, packageSize{Package: pkg, Old: n, Delta: -n})
+		}
+	}
+	sort.Slice(size.Packages, func(i, j int) bool {
+		if size.Packages[i].Delta != size.Packages[j].Delta {
+			return size.Packages[i].Delta > size.Packages[j].Delta
+		}
+		return size.Packages[i].Package < size.Packages[j].Package
+	})
+	return size, nil
+}
+
+// symbolSizes reads a binary's symbol table and totals the size of each
+// package's symbols.
+func (b *buildCmd) symbolSizes(path string) (map[string]int64, error) {
+	out, err := b.p.Command("go", "tool", "nm", "-size", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't read symbols from %s: %v", path, err)
+	}
+	sizes := make(map[string]int64)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		// Each line is an address, size, type, and name.
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || n == 0 {
+			continue
+		}
+		sizes[symbolPackage(strings.Join(fields[3:], " "))] += n
+	}
+	return sizes, s.Err()
+}
+
+// symbolPackage returns the import path of the package that defines a
+// symbol. Type descriptors and linker-generated symbols are grouped
+// separately.
+func symbolPackage(name string) string {
+	switch {
+	case strings.HasPrefix(name, "type:"), strings.HasPrefix(name, "type."):
+		return "(types)"
+	case strings.HasPrefix(name, "go:"), strings.HasPrefix(name, "go."):
+		return "(linker)"
+	}
+	// Instantiated generics can mention other packages in brackets.
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "(other)"
+	}
+	return name[:slash+1+dot]
+}
+
+func formatSizes(binaries []binary) string {
+	buf := bytes.NewBuffer(nil)
+	for _, bin := range binaries {
+		size := bin.Size
+		if size == nil {
+			continue
+		}
+		buf.WriteString("\n")
+		if size.Old == 0 {
+			fmt.Fprintf(buf, "%s is new: %s\n", bin.Path, formatBytes(size.New))
+		} else {
+			fmt.Fprintf(buf, "%s: %s -> %s (%s, %+.1f%%)\n", bin.Path, formatBytes(size.Old), formatBytes(size.New), formatDelta(size.Delta), size.Percent)
+		}
+		w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+		shown := 0
+		for _, ps := range size.Packages {
+			if ps.Delta <= 0 || shown == sizePackages {
+				break
+			}
+			if shown == 0 {
+				fmt.Fprintln(w, "\tPACKAGE\tOLD\tNEW\tDELTA")
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n", ps.Package, formatBytes(ps.Old), formatBytes(ps.New), formatDelta(ps.Delta))
+			shown++
+		}
+		w.Flush()
+	}
+	if buf.Len() == 0 {
+		return "No binary sizes to compare."
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func formatBytes(n int64) string {
+	v := float64(n)
+	for _, s := range []struct {
+		scale float64
+		name  string
+	}{{1e9, "GB"}, {1e6, "MB"}, {1e3, "kB"}} {
+		if math.Abs(v) >= s.scale {
+			return fmt.Sprintf("%.3g%s", v/s.scale, s.name)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func formatDelta(n int64) string {
+	if n > 0 {
+		return "+" + formatBytes(n)
+	}
+	return formatBytes(n)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/project"
+)
+
+// Manifests are written next to each binary, with this suffix.
+const manifestSuffix = ".manifest.json"
+
+// stampFields are the values that --stamp can inject into binaries.
+var stampFields = []string{"version", "commit", "dirty", "time", "branch"}
+
+// A stamp describes the commit that binaries are built from.
+type stamp struct {
+	// Version is the output of git describe, with a -dirty suffix if the
+	// working tree had uncommitted changes.
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// Dirty is true if the working tree had uncommitted changes.
+	Dirty bool `json:"dirty"`
+	// Time is the build time in RFC 3339 format. If SOURCE_DATE_EPOCH is set,
+	// it's used instead of the current time, so that builds are reproducible.
+	Time   string `json:"time"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// A stampVar injects a stamp field into a string variable.
+type stampVar struct {
+	field    string
+	variable string // fully-qualified, like main.version
+}
+
+// A manifest describes a single binary.
+type manifest struct {
+	Package  string `json:"package"`
+	Platform string `json:"platform"`
+	SHA256   string `json:"sha256"`
+	stamp
+}
+
+func newStamp(p *project.Project) (stamp, error) {
+	var s stamp
+	var err error
+	if s.Version, err = p.Describe(); err != nil {
+		return stamp{}, err
+	}
+	if s.Commit, err = p.Canonicalize("HEAD"); err != nil {
+		return stamp{}, err
+	}
+	if s.Dirty, err = p.Dirty(); err != nil {
+		return stamp{}, err
+	}
+	if s.Branch, err = p.Branch(); err != nil {
+		return stamp{}, err
+	}
+	if s.Dirty {
+		s.Version += "-dirty"
+	}
+	built := time.Now()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return stamp{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+		}
+		built = time.Unix(secs, 0)
+	}
+	s.Time = built.UTC().Format(time.RFC3339)
+	return s, nil
+}
+
+func (s stamp) value(field string) string {
+	switch field {
+	case "version":
+		return s.Version
+	case "commit":
+		return s.Commit
+	case "dirty":
+		return strconv.FormatBool(s.Dirty)
+	case "time":
+		return s.Time
+	case "branch":
+		return s.Branch
+	}
+	return ""
+}
+
+// ldflags returns linker flags that set each variable to its stamp field.
+func (s stamp) ldflags(vars []stampVar) (string, error) {
+	flags := make([]string, 0, 2*len(vars))
+	for _, v := range vars {
+		arg, err := quoteFlag(v.variable + "=" + s.value(v.field))
+		if err != nil {
+			return "", fmt.Errorf("can't stamp %s: %v", v.variable, err)
+		}
+		flags = append(flags, "-X", arg)
+	}
+	return strings.Join(flags, " "), nil
+}
+
+// quoteFlag quotes an argument for go build's -ldflags, which splits on
+// spaces and strips single or double quotes around each argument. There's no
+// way to escape a quote inside a quoted argument, so the argument can't
+// contain both kinds.
+func quoteFlag(arg string) (string, error) {
+	switch {
+	case arg != "" && !strings.ContainsAny(arg, " \t\n\r'\""):
+		return arg, nil
+	case !strings.Contains(arg, "'"):
+		return "'" + arg + "'", nil
+	case !strings.Contains(arg, `"`):
+		return `"` + arg + `"`, nil
+	}
+	return "", fmt.Errorf("%q contains both single and double quotes", arg)
+}
+
+// parseStampVars parses --stamp flags in the form field=variable.
+func parseStampVars(specs []string) ([]stampVar, error) {
+	vars := make([]stampVar, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !strings.Contains(parts[1], ".") {
+			return nil, fmt.Errorf("invalid --stamp %q: expected FIELD=package.Variable", spec)
+		}
+		known := false
+		for _, f := range stampFields {
+			known = known || f == parts[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid --stamp %q: field must be one of %s", spec, strings.Join(stampFields, ", "))
+		}
+		vars = append(vars, stampVar{field: parts[0], variable: parts[1]})
+	}
+	return vars, nil
+}
+
+func writeManifest(path string, m manifest) error {
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(bs, '\n'), 0644)
+}
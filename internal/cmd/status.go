@@ -12,9 +12,10 @@ type status struct {
 	p      *project.Project
 	logger *hhlog.Logger
 
-	direct bool
-	base   string
-	json   bool
+	direct   bool
+	base     string
+	json     bool
+	contexts []string
 }
 
 func addStatus(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
@@ -29,15 +30,25 @@ func addStatus(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
 		StringVar(&s.base)
 	cmd.Flag("json", "Format output as JSON.").
 		BoolVar(&s.json)
+	addContextFlag(cmd, &s.contexts)
 }
 
 func (s *status) run(_ *kingpin.ParseContext) error {
+	targets, err := parseTargets(s.contexts)
+	if err != nil {
+		return s.logger.Annotate(err)
+	}
+	diff := func(p *project.Project) (project.Diff, error) {
+		if s.direct {
+			return p.Diff(s.base)
+		}
+		return p.RecursiveDiff(s.base)
+	}
 	var d project.Diff
-	var err error
-	if s.direct {
-		d, err = s.p.Diff(s.base)
+	if len(targets) > 0 {
+		d, err = s.p.ForTargets(targets, diff)
 	} else {
-		d, err = s.p.RecursiveDiff(s.base)
+		d, err = diff(s.p)
 	}
 	if err != nil {
 		return s.logger.Annotate(err)
@@ -47,9 +58,9 @@ func (s *status) run(_ *kingpin.ParseContext) error {
 		if err != nil {
 			return s.logger.Annotate(err)
 		}
-		s.logger.Printf(string(bs))
+		s.logger.Printf("%s", bs)
 	} else {
-		s.logger.Printf(d.String())
+		s.logger.Printf("%s", d)
 	}
 	return nil
 }
@@ -0,0 +1,437 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/discover"
+	"github.com/akshayjshah/hardhat/internal/gotest"
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/project"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Keep a few failing seeds per test; more don't help reproduce the failure.
+const maxSeeds = 3
+
+var shuffleSeed = regexp.MustCompile(`^-test\.shuffle (\d+)`)
+
+// timedOut matches the panic from a test binary that hit its -timeout.
+var timedOut = regexp.MustCompile(`^panic: test timed out after`)
+
+type stress struct {
+	p      *project.Project
+	logger *hhlog.Logger
+
+	all       bool
+	direct    bool
+	base      string
+	testFiles bool
+	budget    time.Duration
+	count     int
+	workers   int
+	race      bool
+	shuffle   bool
+}
+
+// A stressTarget is a package to stress, optionally limited to the tests
+// matching a pattern.
+type stressTarget struct {
+	pkg     string
+	pattern string
+}
+
+type stressKey struct {
+	pkg, test string
+}
+
+// stressStats accumulates results across many concurrent go test runs.
+type stressStats struct {
+	mu          sync.Mutex
+	invocations int
+	runs        map[stressKey]int
+	failures    map[stressKey]int
+	seeds       map[stressKey][]string
+	broken      map[string]bool
+	retired     map[string]bool
+}
+
+func addStress(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
+	s := &stress{p: p, logger: l}
+	cmd := app.Command("stress", "Run tests repeatedly to shake out flaky and racy failures.").Action(s.run)
+	cmd.Flag("direct", "Include only directly modified packages.").
+		Short('d').
+		BoolVar(&s.direct)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&s.base)
+	cmd.Flag("all", "Stress tests in all packages.").
+		Short('a').
+		BoolVar(&s.all)
+	cmd.Flag("test-files", "Stress only the tests defined in modified _test.go files.").
+		BoolVar(&s.testFiles)
+	cmd.Flag("budget", "Stop stressing after this long.").
+		Default("1m").
+		DurationVar(&s.budget)
+	cmd.Flag("count", "Number of times each go test invocation runs each test.").
+		Default("10").
+		IntVar(&s.count)
+	cmd.Flag("workers", "Number of concurrent go test invocations.").
+		Short('p').
+		Default(strconv.Itoa(runtime.NumCPU())).
+		IntVar(&s.workers)
+	cmd.Flag("race", "Enable the race detector.").
+		Default("true").
+		BoolVar(&s.race)
+	cmd.Flag("shuffle", "Randomize the order of tests.").
+		Default("true").
+		BoolVar(&s.shuffle)
+}
+
+func (s *stress) run(_ *kingpin.ParseContext) error {
+	targets, err := s.targets()
+	if err != nil {
+		return s.logger.Annotate(err)
+	}
+	if len(targets) == 0 {
+		s.logger.Printf("No packages need to be stressed.")
+		return nil
+	}
+	if s.workers < 1 {
+		s.workers = 1
+	}
+
+	stats := &stressStats{
+		runs:     make(map[stressKey]int),
+		failures: make(map[stressKey]int),
+		seeds:    make(map[stressKey][]string),
+		broken:   make(map[string]bool),
+		retired:  make(map[string]bool),
+	}
+	s.logger.Printf("Stressing %d packages for %v with %d workers.", len(targets), s.budget, s.workers)
+	deadline := time.Now().Add(s.budget)
+	var next int
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				tg, ok := s.pick(targets, &next, stats)
+				if !ok {
+					return
+				}
+				s.invoke(tg, deadline, stats)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.logger.Printf("%s", s.format(stats))
+	if len(stats.failures) > 0 || len(stats.broken) > 0 {
+		return s.logger.Annotate(fmt.Errorf("stress testing found failures"))
+	}
+	return nil
+}
+
+func (s *stress) targets() ([]stressTarget, error) {
+	var d project.Diff
+	var err error
+	if s.all {
+		d, err = s.p.All()
+	} else if s.direct || s.testFiles {
+		d, err = s.p.Diff(s.base)
+	} else {
+		d, err = s.p.RecursiveDiff(s.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.testFiles {
+		return s.testFileTargets(d)
+	}
+	var targets []stressTarget
+	for _, pd := range d.Packages {
+		if pd.Status == project.StatusModified {
+			targets = append(targets, stressTarget{pkg: pd.Path})
+		}
+	}
+	return targets, nil
+}
+
+// testFileTargets limits stress testing to the tests declared in modified
+// _test.go files.
+func (s *stress) testFileTargets(d project.Diff) ([]stressTarget, error) {
+	tests := make(map[string][]string)
+	for _, pd := range d.Files {
+		if pd.Status != project.StatusModified || !strings.HasSuffix(pd.Path, "_test.go") {
+			continue
+		}
+		funcs, err := discover.File(filepath.Join(s.p.Dir(), pd.Path))
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := s.p.ImportPath(filepath.Dir(pd.Path))
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range funcs {
+			if fn.Kind == discover.KindTest {
+				tests[pkg] = append(tests[pkg], regexp.QuoteMeta(fn.Name))
+			}
+		}
+	}
+	targets := make([]stressTarget, 0, len(tests))
+	for pkg, names := range tests {
+		sort.Strings(names)
+		targets = append(targets, stressTarget{
+			pkg:     pkg,
+			pattern: "^(" + strings.Join(names, "|") + ")$",
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].pkg < targets[j].pkg
+	})
+	return targets, nil
+}
+
+// pick chooses the next target round-robin, skipping packages that don't
+// build or don't have any tests.
+func (s *stress) pick(targets []stressTarget, next *int, stats *stressStats) (stressTarget, bool) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	for range targets {
+		tg := targets[*next%len(targets)]
+		*next++
+		if !stats.retired[tg.pkg] {
+			return tg, true
+		}
+	}
+	return stressTarget{}, false
+}
+
+func (s *stress) args(tg stressTarget, count int, seed string) []string {
+	args := []string{"test", "-count", strconv.Itoa(count)}
+	if s.race {
+		args = append(args, "-race")
+	}
+	if seed != "" {
+		args = append(args, "-shuffle", seed)
+	}
+	if tg.pattern != "" {
+		args = append(args, "-run", tg.pattern)
+	}
+	return append(args, tg.pkg)
+}
+
+// invoke runs go test once for the target and records the results. The test
+// binary times out at the deadline, so a long run can't overrun the budget;
+// tests that were cut off aren't counted.
+func (s *stress) invoke(tg stressTarget, deadline time.Time, stats *stressStats) {
+	seed := ""
+	if s.shuffle {
+		seed = "on"
+	}
+	timeout := time.Until(deadline)
+	if timeout < time.Second {
+		// A zero timeout would disable it entirely.
+		timeout = time.Second
+	}
+	args := s.args(tg, s.count, seed)
+	args = append([]string{args[0], "-json", "-timeout", timeout.String()}, args[1:]...)
+	c := s.p.Command("go", args...)
+	stderr := bytes.NewBuffer(nil)
+	c.Stderr = stderr
+	stdout, err := c.StdoutPipe()
+	if err == nil {
+		err = c.Start()
+	}
+	if err != nil {
+		s.logger.Printf("Couldn't run go test for %s: %v", tg.pkg, err)
+		stats.retire(tg.pkg, true)
+		return
+	}
+
+	runs := make(map[stressKey]int)
+	failures := make(map[stressKey]int)
+	var ran, pkgFailed, cutOff bool
+	scanErr := gotest.Scan(stdout, func(e gotest.Event) {
+		if e.Action == "output" && timedOut.MatchString(e.Output) {
+			cutOff = true
+		}
+		if cutOff {
+			// Tests still running at the deadline may be reported as
+			// failures, so only count the runs that finished in time.
+			return
+		}
+		if e.Test == "" {
+			if m := shuffleSeed.FindStringSubmatch(e.Output); m != nil {
+				seed = m[1]
+			}
+			if e.Action == "fail" {
+				pkgFailed = true
+			}
+			return
+		}
+		key := stressKey{tg.pkg, e.Test}
+		switch e.Action {
+		case "pass":
+			runs[key]++
+			ran = true
+		case "fail":
+			runs[key]++
+			failures[key]++
+			ran = true
+		}
+	}, func([]byte) {})
+	waitErr := c.Wait()
+	if _, ok := waitErr.(*exec.ExitError); ok && (pkgFailed || cutOff) {
+		// go test exits with an error whenever tests fail or time out.
+		waitErr = nil
+	}
+	if scanErr != nil || waitErr != nil {
+		if scanErr == nil {
+			scanErr = waitErr
+		}
+		s.logger.Printf("Couldn't run go test for %s: %v\n%s", tg.pkg, scanErr, strings.TrimSpace(stderr.String()))
+		stats.retire(tg.pkg, true)
+		return
+	}
+
+	if cutOff {
+		s.logger.Debugf("stopped stressing %s at the deadline", tg.pkg)
+		if !ran {
+			return
+		}
+	} else if pkgFailed && !ran {
+		s.logger.Printf("Package %s failed without running any tests; no longer stressing it.\n%s",
+			tg.pkg, strings.TrimSpace(stderr.String()))
+		stats.retire(tg.pkg, true)
+		return
+	}
+	if !ran {
+		s.logger.Debugf("no tests to stress in %s", tg.pkg)
+		stats.retire(tg.pkg, false)
+		return
+	}
+	stats.add(runs, failures, seed)
+	for key := range failures {
+		if !strings.Contains(key.test, "/") {
+			s.logger.Printf("FAIL\t%s\t%s\t(seed %s)", key.pkg, key.test, seed)
+		}
+	}
+}
+
+func (s *stress) format(stats *stressStats) string {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	total := 0
+	for _, n := range stats.runs {
+		total += n
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "Ran %d go test invocations, with %d test runs in total.\n", stats.invocations, total)
+	for pkg := range stats.broken {
+		fmt.Fprintf(buf, "Package %s failed without running any tests.\n", pkg)
+	}
+	if len(stats.failures) == 0 {
+		fmt.Fprintf(buf, "No test failures.")
+		return strings.TrimSpace(buf.String())
+	}
+
+	keys := make([]stressKey, 0, len(stats.failures))
+	for key := range stats.failures {
+		keys = append(keys, key)
+	}
+	rate := func(k stressKey) float64 {
+		return float64(stats.failures[k]) / float64(stats.runs[k])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rate(keys[i]), rate(keys[j]); ri != rj {
+			return ri > rj
+		}
+		if keys[i].pkg != keys[j].pkg {
+			return keys[i].pkg < keys[j].pkg
+		}
+		return keys[i].test < keys[j].test
+	})
+
+	fmt.Fprintf(buf, "%d tests failed at least once:\n", len(keys))
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tTEST\tRUNS\tFAILURES\tRATE\tSEEDS")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\t%s\n",
+			k.pkg,
+			k.test,
+			stats.runs[k],
+			stats.failures[k],
+			rate(k)*100,
+			strings.Join(stats.seeds[k], " "),
+		)
+	}
+	w.Flush()
+
+	buf.WriteString("\nTo reproduce:\n")
+	for _, k := range keys {
+		if strings.Contains(k.test, "/") {
+			// The top-level test's command line covers its subtests.
+			continue
+		}
+		seed := ""
+		if seeds := stats.seeds[k]; len(seeds) > 0 {
+			seed = seeds[0]
+		}
+		tg := stressTarget{pkg: k.pkg, pattern: "^" + regexp.QuoteMeta(k.test) + "$"}
+		fmt.Fprintf(buf, "\tgo %s\n", strings.Join(quoteArgs(s.args(tg, s.count, seed)), " "))
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func (st *stressStats) add(runs, failures map[stressKey]int, seed string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.invocations++
+	for k, n := range runs {
+		st.runs[k] += n
+	}
+	for k, n := range failures {
+		st.failures[k] += n
+		if seed != "" && len(st.seeds[k]) < maxSeeds {
+			st.seeds[k] = append(st.seeds[k], seed)
+		}
+	}
+}
+
+// retire stops scheduling runs for a package.
+func (st *stressStats) retire(pkg string, broken bool) {
+	st.mu.Lock()
+	st.retired[pkg] = true
+	if broken {
+		st.broken[pkg] = true
+	}
+	st.mu.Unlock()
+}
+
+// quoteArgs single-quotes any arguments that a shell would interpret.
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, "^$|()*?[]{}\\ '\"") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		quoted[i] = arg
+	}
+	return quoted
+}
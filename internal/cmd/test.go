@@ -1,31 +1,84 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/akshayjshah/hardhat/internal/gotest"
 	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
 	"github.com/akshayjshah/hardhat/internal/project"
+	"github.com/akshayjshah/hardhat/internal/quarantine"
+	"github.com/akshayjshah/hardhat/internal/schedule"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+// When selecting tests to fit a time budget, consider how often packages
+// changed in this many recent commits.
+const changeHistory = 200
+
+var skipReasons = map[string]string{
+	"fail-fast": "stopped after a failure",
+	"budget":    "didn't fit the time budget",
+}
+
 type test struct {
 	p      *project.Project
+	store  *history.Store
 	logger *hhlog.Logger
 
-	verbose   bool
-	all       bool
-	direct    bool
-	base      string
-	race      bool
-	cover     bool
-	covermode string
-	list      string
-	only      string // go test -run
-	bench     string
+	verbose bool
+	all     bool
+	direct  bool
+	base    string
+	race    bool
+	list    string
+	// listFormat is text or json.
+	listFormat string
+	only       string // go test -run
+	bench      string
+
+	retries      int
+	jsonReport   string
+	junitReport  string
+	quarantine   string
+	workers      int
+	batch        int
+	failFast     bool
+	budget       time.Duration
+	selection    string
+	changedTests bool
+	contexts     []string
+	// tests limits the tests run in some packages to the named top-level
+	// test functions, keyed by import path.
+	tests map[string][]string
+
+	cover          bool
+	covermode      string
+	coverpkg       string
+	coverprofile   string
+	coverHTML      string
+	coverCobertura string
+	coverFlags     []string
+
+	diffCoverage    bool
+	diffCoverageMin float64
 }
 
-func addTest(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
-	t := &test{p: p, logger: l}
+func addTest(app *kingpin.Application, p *project.Project, s *history.Store, l *hhlog.Logger) {
+	t := &test{p: p, store: s, logger: l}
 	cmd := app.Command("test", "Run unit tests.").Action(t.run)
 	cmd.Flag("verbose", "Increase output verbosity.").
 		Short('v').
@@ -48,68 +101,503 @@ func addTest(app *kingpin.Application, p *project.Project, l *hhlog.Logger) {
 		BoolVar(&t.cover)
 	cmd.Flag("covermode", "Coverage calculation mode.").
 		EnumVar(&t.covermode, "set", "count", "atomic")
-	cmd.Flag("list", "List tests matching a regexp without running them.").
+	cmd.Flag("coverpkg", "Apply coverage analysis to packages matching these comma-separated patterns. Use \"affected\" for all tested packages.").
+		StringVar(&t.coverpkg)
+	cmd.Flag("coverprofile", "Write a merged coverage profile to this file.").
+		PlaceHolder("FILE").
+		StringVar(&t.coverprofile)
+	cmd.Flag("cover-html", "Write an HTML coverage report to this file.").
+		PlaceHolder("FILE").
+		StringVar(&t.coverHTML)
+	cmd.Flag("cover-cobertura", "Write a Cobertura XML coverage report to this file.").
+		PlaceHolder("FILE").
+		StringVar(&t.coverCobertura)
+	cmd.Flag("diff-coverage", "Report the coverage of lines changed since the base commit.").
+		BoolVar(&t.diffCoverage)
+	cmd.Flag("diff-coverage-threshold", "Fail if less than this percentage of changed lines are covered.").
+		Default("0").
+		FloatVar(&t.diffCoverageMin)
+	cmd.Flag("list", "List tests, benchmarks, examples, and fuzz targets matching a regexp without compiling or running them.").
 		StringVar(&t.list)
+	cmd.Flag("list-format", "Format for --list output.").
+		Default("text").
+		EnumVar(&t.listFormat, "text", "json")
 	cmd.Flag("run", "Run only tests matching a regexp.").
 		StringVar(&t.only)
-	cmd.Flag("bench", "Also run benchmarks matching a regexp, including memory profiling.").
+	cmd.Flag("bench", "Also run benchmarks matching a regexp, including memory profiling. They run once, so use hardhat bench to check them for regressions.").
 		StringVar(&t.bench)
-
+	cmd.Flag("retries", "Re-run failed tests up to this many times, marking tests that eventually pass as flaky.").
+		IntVar(&t.retries)
+	cmd.Flag("json-report", "Write a JSON report of the results to this file.").
+		PlaceHolder("FILE").
+		StringVar(&t.jsonReport)
+	cmd.Flag("junit-report", "Write a JUnit XML report of the results to this file.").
+		PlaceHolder("FILE").
+		StringVar(&t.junitReport)
+	cmd.Flag("quarantine", "File listing quarantined tests, relative to the repository root.").
+		Default(quarantine.DefaultPath).
+		PlaceHolder("FILE").
+		StringVar(&t.quarantine)
+	cmd.Flag("workers", "Number of concurrent go test invocations.").
+		Short('p').
+		Default(strconv.Itoa(runtime.NumCPU())).
+		IntVar(&t.workers)
+	cmd.Flag("batch", "Number of packages tested by each go test invocation.").
+		Default("1").
+		IntVar(&t.batch)
+	cmd.Flag("fail-fast", "Stop starting new go test invocations after the first failure.").
+		BoolVar(&t.failFast)
+	cmd.Flag("budget", "Test only the most valuable packages that fit in this much time, based on past runs.").
+		DurationVar(&t.budget)
+	cmd.Flag("select", "How to select tests: by affected package, by the coverage map's record of which tests executed the changed lines, by which tests can call the changed functions, or not at all.").
+		Default("package").
+		EnumVar(&t.selection, "package", "coverage", "callgraph", "none")
+	cmd.Flag("changed-tests", "Also run the test functions added or modified since the base commit. Package-level selection then ignores changes to test files; use --select=none to run only the changed tests.").
+		BoolVar(&t.changedTests)
+	addContextFlag(cmd, &t.contexts)
 }
 
 func (t *test) run(_ *kingpin.ParseContext) error {
+	targets, err := parseTargets(t.contexts)
+	if err != nil {
+		return t.logger.Annotate(err)
+	}
+	if len(targets) == 0 {
+		if err := t.selectAndTest(); err != nil {
+			return t.logger.Annotate(err)
+		}
+		return nil
+	}
+	// Test each context separately, writing reports and coverage to
+	// per-context files. Contexts for other platforms need an exec wrapper
+	// named go_$GOOS_$GOARCH_exec on the PATH, as with go test itself.
+	var failed []string
+	for _, target := range targets {
+		tc := *t
+		tc.p = t.p.WithTarget(target)
+		tc.jsonReport = contextPath(t.jsonReport, target)
+		tc.junitReport = contextPath(t.junitReport, target)
+		tc.coverprofile = contextPath(t.coverprofile, target)
+		tc.coverHTML = contextPath(t.coverHTML, target)
+		tc.coverCobertura = contextPath(t.coverCobertura, target)
+		t.logger.Printf("Context %s:", target)
+		if err := tc.selectAndTest(); err != nil {
+			t.logger.Printf("%v", err)
+			failed = append(failed, target.String())
+		}
+	}
+	if len(failed) > 0 {
+		return t.logger.Annotate(fmt.Errorf("tests failed in %d of %d contexts: %s", len(failed), len(targets), strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// selectAndTest selects packages and tests in the project's context and runs
+// them.
+func (t *test) selectAndTest() error {
 	var d project.Diff
 	var err error
-	if t.all {
-		d, err = t.p.All()
-	} else if t.direct {
+	if t.selection != "package" && (t.all || t.only != "") {
+		return fmt.Errorf("--select=%s can't be combined with --all or --run", t.selection)
+	}
+	if t.changedTests && (t.all || t.only != "") {
+		return errors.New("--changed-tests can't be combined with --all or --run")
+	}
+	switch t.selection {
+	case "coverage":
+		d, err = t.selectByCoverage()
+	case "callgraph":
+		d, err = t.selectByCallGraph()
+	case "none":
 		d, err = t.p.Diff(t.base)
-	} else {
-		d, err = t.p.RecursiveDiff(t.base)
+		d.Packages = nil
+	default:
+		if t.changedTests {
+			d, err = t.sourceDiff()
+		} else {
+			d, err = t.packageDiff()
+		}
+	}
+	if err == nil && t.changedTests {
+		d, err = t.addChangedTests(d)
 	}
 	if err != nil {
-		return t.logger.Annotate(err)
+		return err
+	}
+	if t.list != "" {
+		return t.listTests(d)
 	}
 	return t.test(d)
 }
 
-func (t *test) test(d project.Diff) error {
-	args := []string{"test"}
-	if t.verbose {
-		args = append(args, "-v")
-	}
-	if t.race {
-		args = append(args, "-race")
-	}
-	if t.cover {
-		args = append(args, "-cover")
+// packageDiff selects the packages to test.
+func (t *test) packageDiff() (project.Diff, error) {
+	if t.all {
+		return t.p.All()
+	} else if t.direct {
+		return t.p.Diff(t.base)
 	}
-	if t.covermode != "" {
-		args = append(args, fmt.Sprintf("-%s", t.covermode))
+	return t.p.RecursiveDiff(t.base)
+}
+
+func (t *test) test(d project.Diff) error {
+	q, err := t.loadQuarantine()
+	if err != nil {
+		return err
 	}
-	if t.list != "" {
-		args = append(args, "-list", t.list)
+
+	pkgs, skipped := t.prioritize(d)
+	if len(pkgs) == 0 {
+		if len(skipped) > 0 {
+			t.logger.Printf("No packages fit in the %v budget.", t.budget)
+			report := gotest.Report{Skipped: skipped}
+			t.summarize(report, q)
+			return writeReports(report, t.jsonReport, t.junitReport)
+		}
+		t.logger.Printf("No packages need to be tested.")
+		return nil
 	}
+
+	var args []string
 	if t.only != "" {
 		args = append(args, "-run", t.only)
 	}
 	if t.bench != "" {
 		args = append(args, "-bench", t.bench)
 	}
+	t.coverFlags = t.coverageFlags(pkgs)
+	jobs := t.jobs(pkgs, args)
+	var profiles string
+	if t.profiling() {
+		dir, cleanup, err := tempDir("hardhat-cover")
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		t.addProfiles(jobs, dir)
+		profiles = dir
+	}
+	report, err := t.runner().Run(jobs)
+	report.Skipped = append(report.Skipped, skipped...)
+	t.record(report)
+	var coverErr error
+	if profiles != "" {
+		profile, mergeErr := t.mergeProfiles(profiles)
+		if mergeErr != nil {
+			return mergeErr
+		}
+		if t.diffCoverage {
+			coverErr = t.checkDiffCoverage(profile)
+		}
+	}
 
-	pkgs := make([]string, 0, len(d.Packages))
-	for _, pd := range d.Packages {
-		if pd.Status == project.StatusModified {
-			pkgs = append(pkgs, pd.Path)
+	failed := report.Failed()
+	if failed && t.retries > 0 {
+		t.retry(report)
+		t.recordFlakes(report.Flaky())
+	}
+	report.Quarantine(func(pkg, test string) bool {
+		return q.Match(pkg, test) != nil
+	})
+	t.summarize(report, q)
+	if reportErr := writeReports(report, t.jsonReport, t.junitReport); reportErr != nil {
+		return reportErr
+	}
+	if report.Failed() || (err != nil && !failed) {
+		// If go test failed for reasons other than failing tests, we can't
+		// recover by retrying.
+		if err == nil {
+			err = errors.New("tests failed")
 		}
+		return err
 	}
-	if len(pkgs) == 0 {
-		t.logger.Printf("No packages need to be tested.")
-		return nil
+	if coverErr != nil {
+		return coverErr
 	}
-	args = append(args, pkgs...)
-	if err := t.p.Exec("go", args...); err != nil {
-		return t.logger.Annotate(err)
+	return nil
+}
+
+// prioritize orders the packages to test so that the most likely failures
+// are reported first. If the run has a time budget, it also returns the
+// packages that don't fit.
+func (t *test) prioritize(d project.Diff) ([]string, []gotest.SkippedPackage) {
+	timings, err := t.store.Timings()
+	if err != nil {
+		t.logger.Printf("Couldn't load test timings, so tests won't be prioritized: %v", err)
+		timings = &history.Timings{}
+	}
+	candidates := schedule.Candidates(d, timings)
+
+	var skipped []gotest.SkippedPackage
+	if t.budget > 0 {
+		candidates, skipped = t.fitBudget(candidates)
+	}
+	schedule.Prioritize(candidates)
+	pkgs := make([]string, len(candidates))
+	for i, c := range candidates {
+		t.logger.Debugf("scheduling %s (distance %d, failure rate %.2f, estimate %v)",
+			c.Path, c.Distance, c.FailureRate, c.Estimate)
+		pkgs[i] = c.Path
+	}
+	return pkgs, skipped
+}
+
+// jobs batches packages into go test invocations, preserving their order.
+// Packages limited to particular tests get an invocation of their own.
+func (t *test) jobs(pkgs []string, args []string) []gotest.Job {
+	n := t.batch
+	if n < 1 {
+		n = len(pkgs)
+	}
+	var jobs []gotest.Job
+	var batch []string
+	flush := func() {
+		if len(batch) > 0 {
+			jobs = append(jobs, gotest.Job{Packages: batch, Args: args})
+			batch = nil
+		}
+	}
+	for _, pkg := range pkgs {
+		if names, ok := t.tests[pkg]; ok {
+			flush()
+			jobArgs := make([]string, 0, len(args)+2)
+			jobArgs = append(jobArgs, args...)
+			jobs = append(jobs, gotest.Job{
+				Packages: []string{pkg},
+				Args:     append(jobArgs, "-run", runPattern(names)),
+			})
+			continue
+		}
+		batch = append(batch, pkg)
+		if len(batch) == n {
+			flush()
+		}
+	}
+	flush()
+	return jobs
+}
+
+// runPattern builds a -run regexp matching exactly the named top-level tests.
+func runPattern(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	sort.Strings(quoted)
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// selectTests limits the tests run in a package to the named ones, adding
+// to any already selected.
+func (t *test) selectTests(pkg string, names []string) {
+	if t.tests == nil {
+		t.tests = make(map[string][]string)
+	}
+	seen := make(map[string]struct{}, len(t.tests[pkg]))
+	for _, name := range t.tests[pkg] {
+		seen[name] = struct{}{}
+	}
+	for _, name := range names {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			t.tests[pkg] = append(t.tests[pkg], name)
+		}
+	}
+	sort.Strings(t.tests[pkg])
+}
+
+// fitBudget selects the most valuable packages that can be tested within the
+// time budget, assuming that all the workers are kept busy.
+func (t *test) fitBudget(candidates []schedule.Candidate) ([]schedule.Candidate, []gotest.SkippedPackage) {
+	changes, err := t.p.ChangeCounts(changeHistory)
+	if err != nil {
+		t.logger.Printf("Couldn't count recent changes, so change frequency won't affect test selection: %v", err)
+	}
+	for i := range candidates {
+		candidates[i].Changes = changes[candidates[i].Path]
+	}
+	schedule.Rank(candidates)
+
+	workers := t.workers
+	if workers < 1 {
+		workers = 1
+	}
+	selected, dropped := schedule.Select(candidates, t.budget*time.Duration(workers))
+	var estimate time.Duration
+	for _, c := range selected {
+		estimate += c.Estimate
+	}
+	t.logger.Printf("Selected %d of %d packages to fit the %v budget (estimated %v of testing).",
+		len(selected), len(candidates), t.budget, roundDuration(estimate/time.Duration(workers)))
+
+	skipped := make([]gotest.SkippedPackage, len(dropped))
+	for i, c := range dropped {
+		skipped[i] = gotest.SkippedPackage{Package: c.Path, Reason: "budget"}
+	}
+	return selected, skipped
+}
+
+// runner returns a Runner configured with the go test arguments shared by
+// every invocation.
+func (t *test) runner() *gotest.Runner {
+	var flags []string
+	if t.race {
+		flags = append(flags, "-race")
+	}
+	if target, ok := t.p.Target(); ok && len(target.Tags) > 0 {
+		flags = append(flags, "-tags", strings.Join(target.Tags, ","))
+	}
+	flags = append(flags, t.coverFlags...)
+	return &gotest.Runner{
+		Command: func(args ...string) *exec.Cmd {
+			return t.p.Command("go", args...)
+		},
+		Args:     flags,
+		Workers:  t.workers,
+		FailFast: t.failFast,
+		Verbose:  t.verbose,
+		Out:      os.Stdout,
+	}
+}
+
+// retry re-runs the failed tests in each package, folding the results back
+// into the report.
+func (t *test) retry(r gotest.Report) {
+	for attempt := 1; attempt <= t.retries && r.Failed(); attempt++ {
+		var jobs []gotest.Job
+		for _, pkg := range r.Packages {
+			pattern := pkg.FailedPattern()
+			if pattern == "" {
+				// Packages that fail without any failing tests (usually
+				// because they don't compile) can't be retried.
+				continue
+			}
+			t.logger.Printf("Retrying failed tests in %s (attempt %d of %d).", pkg.Path, attempt, t.retries)
+			jobs = append(jobs, gotest.Job{
+				Packages: []string{pkg.Path},
+				Args:     []string{"-count=1", "-run", pattern},
+			})
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		retried, err := t.runner().Run(jobs)
+		if err != nil {
+			t.logger.Debugf("retry attempt %d failed: %v", attempt, err)
+		}
+		for _, pkg := range r.Packages {
+			if rp := retried.Package(pkg.Path); rp != nil {
+				pkg.Merge(rp)
+			}
+		}
+	}
+}
+
+// loadQuarantine reads the quarantine list, refusing to continue if any
+// entries have expired.
+func (t *test) loadQuarantine() (*quarantine.List, error) {
+	path := t.quarantine
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.p.Dir(), path)
+	}
+	q, err := quarantine.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	expired := q.Expired(time.Now())
+	if len(expired) == 0 {
+		return q, nil
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "%d quarantine entries in %s have expired:\n", len(expired), t.quarantine)
+	for _, e := range expired {
+		fmt.Fprintf(buf, "\t%s\t(owner %s, expired %s)\n", e, e.Owner, e.Expires)
+	}
+	return nil, errors.New(strings.TrimSpace(buf.String()))
+}
+
+func (t *test) summarize(r gotest.Report, q *quarantine.List) {
+	buf := bytes.NewBuffer(nil)
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(buf, "%d packages weren't tested:\n", len(r.Skipped))
+		for _, sp := range r.Skipped {
+			fmt.Fprintf(buf, "\t%s\t(%s)\n", sp.Package, skipReasons[sp.Reason])
+		}
+	}
+	if flaky := r.Flaky(); len(flaky) > 0 {
+		fmt.Fprintf(buf, "%d flaky tests passed on retry:\n", len(flaky))
+		for _, ft := range flaky {
+			fmt.Fprintf(buf, "\t%s\t%s\n", ft.Package, ft.Test)
+		}
+	}
+	// Parents that failed only because of quarantined subtests don't have
+	// entries of their own, so they aren't listed.
+	var listed []string
+	for _, qt := range r.Quarantined() {
+		if e := q.Match(qt.Package, qt.Test); e != nil {
+			listed = append(listed, fmt.Sprintf("\t%s\t%s\t(owner %s)\n", qt.Package, qt.Test, e.Owner))
+		}
+	}
+	if len(listed) > 0 {
+		fmt.Fprintf(buf, "%d quarantined tests failed, but don't fail the run:\n", len(listed))
+		buf.WriteString(strings.Join(listed, ""))
+	}
+	if buf.Len() > 0 {
+		t.logger.Printf("%s", strings.TrimSpace(buf.String()))
+	}
+}
+
+// writeReports writes the report in JSON and JUnit formats, skipping formats
+// without a file name.
+func writeReports(r gotest.Report, jsonReport, junitReport string) error {
+	if jsonReport != "" {
+		bs, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(jsonReport, append(bs, '\n'), 0644); err != nil {
+			return fmt.Errorf("can't write JSON report: %v", err)
+		}
+	}
+	if junitReport != "" {
+		f, err := os.Create(junitReport)
+		if err != nil {
+			return fmt.Errorf("can't write JUnit report: %v", err)
+		}
+		defer f.Close()
+		if err := r.WriteJUnit(f); err != nil {
+			return fmt.Errorf("can't write JUnit report: %v", err)
+		}
 	}
 	return nil
 }
+
+// recordFlakes saves the tests that passed only after a retry.
+func (t *test) recordFlakes(flaky []gotest.FlakyTest) {
+	if len(flaky) == 0 {
+		return
+	}
+	flakes, err := t.store.Flakes()
+	if err != nil {
+		t.logger.Printf("Couldn't load flaky tests: %v", err)
+		return
+	}
+	flakes.Record(flaky, time.Now())
+	if err := t.store.SaveFlakes(flakes); err != nil {
+		t.logger.Printf("Couldn't save flaky tests: %v", err)
+	}
+}
+
+// record saves the timings from a test run. Failing to save timings shouldn't
+// fail the run, so errors are only logged.
+func (t *test) record(r gotest.Report) {
+	timings, err := t.store.Timings()
+	if err != nil {
+		t.logger.Printf("Couldn't load test timings: %v", err)
+		return
+	}
+	timings.Record(r, time.Now())
+	if err := t.store.SaveTimings(timings); err != nil {
+		t.logger.Printf("Couldn't save test timings: %v", err)
+	}
+}
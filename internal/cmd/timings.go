@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// A trend needs a few prior runs before its median means anything.
+const minTrendRuns = 4
+
+type timings struct {
+	store  *history.Store
+	logger *hhlog.Logger
+
+	window    int
+	threshold int // percent
+	json      bool
+	packages  []string
+}
+
+type packageTrend struct {
+	Path  string        `json:"path"`
+	Trend history.Trend `json:"trend"`
+}
+
+type testTrend struct {
+	Package string        `json:"package"`
+	Test    string        `json:"test"`
+	Trend   history.Trend `json:"trend"`
+}
+
+type timingsReport struct {
+	Packages []packageTrend `json:"packages"`
+	Slower   []testTrend    `json:"slower"`
+}
+
+func addTimings(app *kingpin.Application, s *history.Store, l *hhlog.Logger) {
+	t := &timings{store: s, logger: l}
+	cmd := app.Command("timings", "Show historical test timings.").Action(t.run)
+	cmd.Flag("window", "Number of previous runs used to compute the rolling median.").
+		Short('w').
+		Default("10").
+		IntVar(&t.window)
+	cmd.Flag("threshold", "Flag tests whose latest run exceeds the rolling median by this percentage.").
+		Short('t').
+		Default("20").
+		IntVar(&t.threshold)
+	cmd.Flag("json", "Format output as JSON.").
+		BoolVar(&t.json)
+	cmd.Arg("packages", "Show only these packages.").
+		StringsVar(&t.packages)
+}
+
+func (t *timings) run(_ *kingpin.ParseContext) error {
+	stored, err := t.store.Timings()
+	if err != nil {
+		return t.logger.Annotate(err)
+	}
+	report := t.analyze(stored)
+	if t.json {
+		bs, err := json.Marshal(report)
+		if err != nil {
+			return t.logger.Annotate(err)
+		}
+		t.logger.Printf("%s", bs)
+		return nil
+	}
+	t.logger.Printf("%s", t.format(report))
+	return nil
+}
+
+func (t *timings) analyze(stored *history.Timings) timingsReport {
+	var r timingsReport
+	limit := float64(t.threshold) / 100
+	for _, name := range stored.PackageNames() {
+		if !t.include(name) {
+			continue
+		}
+		pt := stored.Packages[name]
+		r.Packages = append(r.Packages, packageTrend{
+			Path:  name,
+			Trend: history.NewTrend(pt.Samples, t.window),
+		})
+		for test, samples := range pt.Tests {
+			trend := history.NewTrend(samples, t.window)
+			if trend.Runs < minTrendRuns || trend.Change() <= limit {
+				continue
+			}
+			r.Slower = append(r.Slower, testTrend{Package: name, Test: test, Trend: trend})
+		}
+	}
+	sort.Slice(r.Slower, func(i, j int) bool {
+		return r.Slower[i].Trend.Change() > r.Slower[j].Trend.Change()
+	})
+	return r
+}
+
+func (t *timings) include(pkg string) bool {
+	if len(t.packages) == 0 {
+		return true
+	}
+	for _, p := range t.packages {
+		if p == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *timings) format(r timingsReport) string {
+	if len(r.Packages) == 0 {
+		return "No recorded timings."
+	}
+	buf := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tRUNS\tMEDIAN\tLATEST\tCHANGE")
+	for _, pt := range r.Packages {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%s\n",
+			pt.Path,
+			pt.Trend.Runs,
+			roundDuration(pt.Trend.Median),
+			roundDuration(pt.Trend.Latest),
+			formatChange(pt.Trend),
+		)
+	}
+	w.Flush()
+
+	if len(r.Slower) == 0 {
+		buf.WriteString("\nNo tests slower than their rolling median.\n")
+	} else {
+		fmt.Fprintf(buf, "\n%d tests slower than their rolling median:\n", len(r.Slower))
+		for _, tt := range r.Slower {
+			fmt.Fprintf(buf, "\t%s\t%s\t%v (median %v, %s)\n",
+				tt.Package,
+				tt.Test,
+				roundDuration(tt.Trend.Latest),
+				roundDuration(tt.Trend.Median),
+				formatChange(tt.Trend),
+			)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func formatChange(t history.Trend) string {
+	if t.Runs < minTrendRuns {
+		return "-"
+	}
+	return fmt.Sprintf("%+.0f%%", t.Change()*100)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+	"github.com/akshayjshah/hardhat/internal/history"
+	"github.com/akshayjshah/hardhat/internal/project"
+	"github.com/akshayjshah/hardhat/internal/vet"
+	"golang.org/x/tools/go/analysis"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type vetCmd struct {
+	p      *project.Project
+	store  *history.Store
+	logger *hhlog.Logger
+
+	all     bool
+	direct  bool
+	base    string
+	config  string
+	format  string
+	noCache bool
+	newOnly bool
+}
+
+func addVet(app *kingpin.Application, p *project.Project, s *history.Store, l *hhlog.Logger) {
+	v := &vetCmd{p: p, store: s, logger: l}
+	cmd := app.Command("vet", "Run the standard vet analyzers, and any others configured, on affected packages.").Action(v.run)
+	cmd.Flag("direct", "Include only directly modified packages.").
+		Short('d').
+		BoolVar(&v.direct)
+	cmd.Flag("base", "Commitish to compare against.").
+		Default("origin/master").
+		Short('b').
+		StringVar(&v.base)
+	cmd.Flag("all", "Vet all packages.").
+		Short('a').
+		BoolVar(&v.all)
+	cmd.Flag("config", "File configuring the analyzers to run, relative to the repository root.").
+		Default(vet.DefaultPath).
+		PlaceHolder("FILE").
+		StringVar(&v.config)
+	cmd.Flag("format", "Output format.").
+		Default("text").
+		EnumVar(&v.format, "text", "json", "github")
+	cmd.Flag("no-cache", "Vet every package, even if its cached results are current.").
+		BoolVar(&v.noCache)
+	cmd.Flag("new-only", "Report only problems on lines added or modified since the merge base, so that existing problems don't fail the run.").
+		BoolVar(&v.newOnly)
+}
+
+func (v *vetCmd) run(_ *kingpin.ParseContext) error {
+	base := v.base
+	if v.newOnly {
+		// Compare against the merge base, so that packages changed only on
+		// the base branch aren't vetted and then filtered out.
+		mergeBase, err := v.p.MergeBase(v.base)
+		if err != nil {
+			return v.logger.Annotate(err)
+		}
+		base = mergeBase
+	}
+	pkgs, err := v.packages(base)
+	if err != nil {
+		return v.logger.Annotate(err)
+	}
+	if len(pkgs) == 0 {
+		v.logger.Printf("No packages need to be vetted.")
+		return nil
+	}
+	path := v.config
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(v.p.Dir(), path)
+	}
+	cfg, err := vet.Load(path)
+	if err != nil {
+		return v.logger.Annotate(err)
+	}
+	analyzers, err := cfg.Analyzers()
+	if err != nil {
+		return v.logger.Annotate(err)
+	}
+	seed, err := v.seed(cfg)
+	if err != nil {
+		return v.logger.Annotate(err)
+	}
+	results, err := v.store.VetResults()
+	if err != nil {
+		v.logger.Printf("Couldn't load cached vet results: %v", err)
+		results = &history.VetResults{Packages: make(map[string]history.VetResult)}
+	}
+
+	h := &vet.Hasher{
+		Seed:   seed,
+		Import: v.p.Package,
+		Local: func(importPath string) bool {
+			return importPath == v.p.Root() || strings.HasPrefix(importPath, v.p.Root()+"/")
+		},
+	}
+	hashes := make(map[string]string, len(pkgs))
+	diags := make([]vet.Diagnostic, 0)
+	var stale []string
+	for _, pkg := range pkgs {
+		hash, err := h.Hash(pkg)
+		if err != nil {
+			v.logger.Debugf("can't hash %s, so its vet results won't be cached: %v", pkg, err)
+		}
+		hashes[pkg] = hash
+		if cached, ok := results.Lookup(pkg, hash); ok && !v.noCache && hash != "" {
+			diags = append(diags, cached...)
+			continue
+		}
+		stale = append(stale, pkg)
+	}
+	if len(stale) < len(pkgs) {
+		v.logger.Debugf("using cached vet results for %d of %d packages", len(pkgs)-len(stale), len(pkgs))
+	}
+	if len(stale) > 0 {
+		found, err := v.vet(stale, analyzers)
+		if err != nil {
+			return v.logger.Annotate(err)
+		}
+		byPackage := make(map[string][]vet.Diagnostic, len(stale))
+		for _, d := range found {
+			byPackage[d.Package] = append(byPackage[d.Package], d)
+		}
+		for _, pkg := range stale {
+			if hashes[pkg] != "" {
+				results.Record(pkg, hashes[pkg], byPackage[pkg])
+			}
+		}
+		if err := v.store.SaveVetResults(results); err != nil {
+			v.logger.Printf("Couldn't save vet results: %v", err)
+		}
+		diags = append(diags, found...)
+	}
+	vet.Sort(diags)
+	if v.newOnly {
+		all := len(diags)
+		if diags, err = v.newIssues(diags, base); err != nil {
+			return v.logger.Annotate(err)
+		}
+		if ignored := all - len(diags); ignored > 0 && v.format == "text" {
+			v.logger.Printf("Ignoring %d problems on unchanged lines.", ignored)
+		}
+	}
+
+	if err := v.print(diags); err != nil {
+		return v.logger.Annotate(err)
+	}
+	if len(diags) > 0 {
+		return v.logger.Annotate(fmt.Errorf("vet found %d problems", len(diags)))
+	}
+	return nil
+}
+
+func (v *vetCmd) print(diags []vet.Diagnostic) error {
+	buf := bytes.NewBuffer(nil)
+	switch v.format {
+	case "json":
+		bs, err := json.Marshal(diags)
+		if err != nil {
+			return err
+		}
+		buf.Write(bs)
+	case "github":
+		if err := vet.WriteGitHub(buf, diags); err != nil {
+			return err
+		}
+	default:
+		if len(diags) == 0 {
+			buf.WriteString("No problems found.")
+		}
+		if err := vet.WriteText(buf, diags); err != nil {
+			return err
+		}
+	}
+	if buf.Len() > 0 {
+		v.logger.Printf("%s", strings.TrimSpace(buf.String()))
+	}
+	return nil
+}
+
+// newIssues keeps only the diagnostics on lines added or modified since the
+// merge base. Diagnostics without a line are kept if their file changed.
+func (v *vetCmd) newIssues(diags []vet.Diagnostic, mergeBase string) ([]vet.Diagnostic, error) {
+	changed, err := v.p.ChangedLines(mergeBase)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]vet.Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		ranges, ok := changed[filepath.ToSlash(d.File)]
+		if !ok {
+			continue
+		}
+		if d.Line == 0 {
+			kept = append(kept, d)
+			continue
+		}
+		for _, lr := range ranges {
+			if lr.Contains(d.Line) {
+				kept = append(kept, d)
+				break
+			}
+		}
+	}
+	return kept, nil
+}
+
+// packages returns the packages affected by changes since base.
+func (v *vetCmd) packages(base string) ([]string, error) {
+	var d project.Diff
+	var err error
+	if v.all {
+		d, err = v.p.All()
+	} else if v.direct {
+		d, err = v.p.Diff(base)
+	} else {
+		d, err = v.p.RecursiveDiff(base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, pd := range d.Packages {
+		if pd.Status == project.StatusModified {
+			pkgs = append(pkgs, pd.Path)
+		}
+	}
+	return pkgs, nil
+}
+
+// seed identifies everything other than the packages' source that affects
+// vet's results: the go tool, the dependency lock files, the analyzers built
+// into hardhat, and the configuration.
+func (v *vetCmd) seed(cfg *vet.Config) ([]byte, error) {
+	version, err := v.p.Command("go", "version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't find go version: %v", err)
+	}
+	buf := bytes.NewBuffer(version)
+	for _, lock := range []string{"go.sum", "Gopkg.lock"} {
+		if bs, err := ioutil.ReadFile(filepath.Join(v.p.Dir(), lock)); err == nil {
+			buf.Write(bs)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := sha256File(exe)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(buf, "hardhat %s\n%s\n", sum, cfg)
+	return buf.Bytes(), nil
+}
+
+// vet runs the analyzers on the packages.
+func (v *vetCmd) vet(pkgs []string, analyzers []*analysis.Analyzer) ([]vet.Diagnostic, error) {
+	dirs := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		dirs[i] = "./" + filepath.ToSlash(v.p.PackageDir(pkg))
+	}
+	v.logger.Printf("Vetting %d packages.", len(pkgs))
+	l := vet.Loader{
+		Dir: v.p.Dir(),
+		Env: v.p.Environ(os.Environ()),
+		Filename: func(file string) string {
+			return trimRoot(v.p.Dir(), file)
+		},
+	}
+	return l.Run(dirs, analyzers)
+}
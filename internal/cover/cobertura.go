@@ -0,0 +1,135 @@
+package cover
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// WriteCobertura writes the profile in the Cobertura XML format understood
+// by many CI systems. Cobertura reports line coverage, so each line reports
+// the highest count of any block that includes it. The filename function
+// converts the import-path-qualified file names in the profile to paths
+// relative to the source root.
+func (p *Profile) WriteCobertura(w io.Writer, root string, filename func(string) string) error {
+	pkgs := make(map[string]*coberturaPackage)
+	var valid, covered int
+	for _, file := range p.Files() {
+		dir := path.Dir(file)
+		pkg, ok := pkgs[dir]
+		if !ok {
+			pkg = &coberturaPackage{Name: dir, BranchRate: "0"}
+			pkgs[dir] = pkg
+		}
+
+		hits := lineHits(p.Blocks(file))
+		class := coberturaClass{
+			Name:       path.Base(file),
+			Filename:   filename(file),
+			BranchRate: "0",
+			Lines:      make([]coberturaLine, 0, len(hits)),
+		}
+		for l, n := range hits {
+			class.Lines = append(class.Lines, coberturaLine{Number: l, Hits: n})
+		}
+		sort.Slice(class.Lines, func(i, j int) bool {
+			return class.Lines[i].Number < class.Lines[j].Number
+		})
+		fileCovered := countCovered(class.Lines)
+		class.LineRate = rate(fileCovered, len(class.Lines))
+		valid += len(class.Lines)
+		covered += fileCovered
+		pkg.Classes = append(pkg.Classes, class)
+	}
+
+	c := coberturaCoverage{
+		LineRate:     rate(covered, valid),
+		BranchRate:   "0",
+		LinesCovered: covered,
+		LinesValid:   valid,
+		Timestamp:    time.Now().UnixNano() / int64(time.Millisecond),
+		Sources:      []string{root},
+		Packages:     make([]coberturaPackage, 0, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		var pkgValid, pkgCovered int
+		for _, class := range pkg.Classes {
+			pkgValid += len(class.Lines)
+			pkgCovered += countCovered(class.Lines)
+		}
+		pkg.LineRate = rate(pkgCovered, pkgValid)
+		c.Packages = append(c.Packages, *pkg)
+	}
+	sort.Slice(c.Packages, func(i, j int) bool {
+		return c.Packages[i].Name < c.Packages[j].Name
+	})
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func countCovered(lines []coberturaLine) int {
+	n := 0
+	for _, l := range lines {
+		if l.Hits > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func rate(covered, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.4f", float64(covered)/float64(total))
+}
@@ -0,0 +1,160 @@
+package cover
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/akshayjshah/hardhat/internal/git"
+)
+
+// FileDiffCoverage describes the coverage of the changed lines in a single
+// file.
+type FileDiffCoverage struct {
+	File      string `json:"file"`
+	Covered   int    `json:"covered"`
+	Total     int    `json:"total"`
+	Uncovered []int  `json:"uncovered,omitempty"`
+}
+
+// DiffCoverage describes the coverage of the executable lines changed since
+// a base commit.
+type DiffCoverage struct {
+	Files   []FileDiffCoverage `json:"files"`
+	Covered int                `json:"covered"`
+	Total   int                `json:"total"`
+}
+
+// Percent returns the percentage of changed executable lines that were
+// covered. If no executable lines changed, it returns 100.
+func (d DiffCoverage) Percent() float64 {
+	if d.Total == 0 {
+		return 100
+	}
+	return 100 * float64(d.Covered) / float64(d.Total)
+}
+
+// DiffCoverage measures the coverage of changed lines. Only lines where an
+// instrumented statement begins count as executable; changes to comments,
+// blank lines, closing braces, declarations, and files that weren't
+// instrumented are ignored. The changed lines are keyed by path relative to
+// the repository root, and the filename function converts the profile's file
+// names to the same form. Source files are read from the root directory.
+func (p *Profile) DiffCoverage(changed map[string][]git.LineRange, root string, filename func(string) string) (DiffCoverage, error) {
+	var d DiffCoverage
+	for _, file := range p.Files() {
+		name := filename(file)
+		ranges, ok := changed[name]
+		if !ok {
+			continue
+		}
+		src, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return DiffCoverage{}, err
+		}
+		stmts, err := statements(name, src)
+		if err != nil {
+			return DiffCoverage{}, err
+		}
+		fd := fileDiffCoverage(name, p.Blocks(file), stmts, ranges)
+		if fd.Total == 0 {
+			continue
+		}
+		d.Files = append(d.Files, fd)
+		d.Covered += fd.Covered
+		d.Total += fd.Total
+	}
+	return d, nil
+}
+
+// fileDiffCoverage measures the coverage of the changed statements in a
+// single file. Each statement takes the count of the block that contains its
+// first character.
+func fileDiffCoverage(name string, blocks []Block, stmts []token.Position, ranges []git.LineRange) FileDiffCoverage {
+	fd := FileDiffCoverage{File: name}
+	hits := make(map[int]int)
+	for _, pos := range stmts {
+		if !inRanges(ranges, pos.Line) {
+			continue
+		}
+		for _, b := range blocks {
+			if !b.contains(pos.Line, pos.Column) {
+				continue
+			}
+			if n, ok := hits[pos.Line]; !ok || b.Count > n {
+				hits[pos.Line] = b.Count
+			}
+		}
+	}
+	lines := make([]int, 0, len(hits))
+	for l := range hits {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	for _, l := range lines {
+		fd.Total++
+		if hits[l] > 0 {
+			fd.Covered++
+		} else {
+			fd.Uncovered = append(fd.Uncovered, l)
+		}
+	}
+	return fd
+}
+
+// statements returns the position of every statement in a file's function
+// bodies. Blocks, case clauses, and labels aren't statements the cover tool
+// counts, but the statements inside them are. The send or receive that
+// begins a select case is part of the select, so it isn't counted either.
+func statements(filename string, src []byte) ([]token.Position, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %q: %v", filename, err)
+	}
+	var stmts []token.Position
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		stmt, ok := n.(ast.Stmt)
+		if !ok {
+			return true
+		}
+		switch stmt := stmt.(type) {
+		case *ast.CommClause:
+			for _, s := range stmt.Body {
+				ast.Inspect(s, visit)
+			}
+			return false
+		case *ast.BlockStmt, *ast.CaseClause, *ast.LabeledStmt, *ast.EmptyStmt:
+		default:
+			stmts = append(stmts, fset.Position(stmt.Pos()))
+		}
+		return true
+	}
+	ast.Inspect(f, visit)
+	return stmts, nil
+}
+
+// contains reports whether the block includes the supplied position.
+func (b Block) contains(line, col int) bool {
+	if line < b.StartLine || line > b.EndLine {
+		return false
+	}
+	if line == b.StartLine && col < b.StartCol {
+		return false
+	}
+	return line != b.EndLine || col < b.EndCol
+}
+
+func inRanges(ranges []git.LineRange, line int) bool {
+	for _, r := range ranges {
+		if r.Contains(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akshayjshah/hardhat/internal/git"
+)
+
+const diffSrc = `package p
+
+func F(x int) int {
+	// A comment.
+	if x > 0 {
+		return 1
+	}
+
+	return 0
+}
+`
+
+const diffProfile = `mode: set
+example.com/p/p.go:3.19,5.11 1 1
+example.com/p/p.go:5.11,7.3 1 0
+example.com/p/p.go:9.2,9.10 1 1
+`
+
+func TestDiffCoverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed []git.LineRange
+		want    DiffCoverage
+	}{
+		{
+			name:    "whole file",
+			changed: []git.LineRange{{Start: 1, End: 10}},
+			want: DiffCoverage{
+				Files:   []FileDiffCoverage{{File: "p.go", Covered: 2, Total: 3, Uncovered: []int{6}}},
+				Covered: 2,
+				Total:   3,
+			},
+		},
+		{
+			name:    "covered statement",
+			changed: []git.LineRange{{Start: 9, End: 9}},
+			want: DiffCoverage{
+				Files:   []FileDiffCoverage{{File: "p.go", Covered: 1, Total: 1}},
+				Covered: 1,
+				Total:   1,
+			},
+		},
+		{
+			name: "comments, blank lines, and braces",
+			changed: []git.LineRange{
+				{Start: 2, End: 4},
+				{Start: 7, End: 8},
+				{Start: 10, End: 10},
+			},
+			want: DiffCoverage{},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "hardhat-cover-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "p.go"), []byte(diffSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := NewProfile()
+	if err := p.Merge(strings.NewReader(diffProfile)); err != nil {
+		t.Fatal(err)
+	}
+	filename := func(f string) string { return strings.TrimPrefix(f, "example.com/p/") }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := map[string][]git.LineRange{"p.go": tt.changed}
+			got, err := p.DiffCoverage(changed, dir, filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffCoverage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatements(t *testing.T) {
+	src := `package p
+
+func F(ch chan int) {
+	for {
+		select {
+		case v := <-ch:
+			_ = v
+		default:
+		}
+	}
+loop:
+	;
+	goto loop
+}
+`
+	stmts, err := statements("p.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, pos := range stmts {
+		lines = append(lines, pos.Line)
+	}
+	// The for, select, assignment, and goto begin statements; the case
+	// clauses, label, and empty statement don't.
+	want := []int{4, 5, 7, 13}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("statement lines = %v, want %v", lines, want)
+	}
+}
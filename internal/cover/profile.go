@@ -0,0 +1,184 @@
+// Package cover reads, merges, and writes Go coverage profiles.
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Block is a range of source covered by a single counter.
+type Block struct {
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+type span struct {
+	startLine, startCol, endLine, endCol int
+}
+
+// A Profile is a coverage profile, possibly merged from several go test
+// invocations. Files are identified by their import path, as in the profiles
+// written by go test.
+type Profile struct {
+	Mode  string
+	files map[string]map[span]*Block
+}
+
+// NewProfile constructs an empty profile.
+func NewProfile() *Profile {
+	return &Profile{files: make(map[string]map[span]*Block)}
+}
+
+// Merge parses a profile written by go test and merges it into this one.
+// When packages are instrumented with -coverpkg, several profiles may
+// include the same block. In set mode, a block is covered if any profile
+// covers it; in count and atomic modes, the counts are summed.
+func (p *Profile) Merge(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "mode: ") {
+			mode := strings.TrimPrefix(text, "mode: ")
+			if p.Mode != "" && p.Mode != mode {
+				return fmt.Errorf("can't merge %s coverage into %s coverage", mode, p.Mode)
+			}
+			p.Mode = mode
+			continue
+		}
+		file, b, err := parseBlock(text)
+		if err != nil {
+			return fmt.Errorf("line %d of coverage profile: %v", line, err)
+		}
+		p.add(file, b)
+	}
+	return scanner.Err()
+}
+
+func (p *Profile) add(file string, b Block) {
+	blocks, ok := p.files[file]
+	if !ok {
+		blocks = make(map[span]*Block)
+		p.files[file] = blocks
+	}
+	key := span{b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+	existing, ok := blocks[key]
+	if !ok {
+		blocks[key] = &b
+		return
+	}
+	if p.Mode == "set" {
+		if b.Count > existing.Count {
+			existing.Count = b.Count
+		}
+		return
+	}
+	existing.Count += b.Count
+}
+
+// Files returns the names of the files in the profile, sorted.
+func (p *Profile) Files() []string {
+	names := make([]string, 0, len(p.files))
+	for name := range p.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Blocks returns the blocks for a file, sorted by position.
+func (p *Profile) Blocks(file string) []Block {
+	blocks := make([]Block, 0, len(p.files[file]))
+	for _, b := range p.files[file] {
+		blocks = append(blocks, *b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].StartLine != blocks[j].StartLine {
+			return blocks[i].StartLine < blocks[j].StartLine
+		}
+		return blocks[i].StartCol < blocks[j].StartCol
+	})
+	return blocks
+}
+
+// Statements returns the number of statements in the profile and the number
+// of those that were covered.
+func (p *Profile) Statements() (total, covered int) {
+	for _, blocks := range p.files {
+		for _, b := range blocks {
+			total += b.NumStmt
+			if b.Count > 0 {
+				covered += b.NumStmt
+			}
+		}
+	}
+	return total, covered
+}
+
+// Percent returns the percentage of statements covered.
+func (p *Profile) Percent() float64 {
+	total, covered := p.Statements()
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// Write writes the profile in the format understood by "go tool cover".
+func (p *Profile) Write(w io.Writer) error {
+	mode := p.Mode
+	if mode == "" {
+		mode = "set"
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", mode)
+	for _, file := range p.Files() {
+		for _, b := range p.Blocks(file) {
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n",
+				file, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// parseBlock parses a line like
+// "example.com/pkg/file.go:10.2,12.16 2 1".
+func parseBlock(line string) (string, Block, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return "", Block{}, fmt.Errorf("missing file name in %q", line)
+	}
+	file := line[:colon]
+	var b Block
+	n, err := fmt.Sscanf(line[colon+1:], "%d.%d,%d.%d %d %d",
+		&b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count)
+	if err != nil || n != 6 {
+		return "", Block{}, fmt.Errorf("malformed block %q", line)
+	}
+	return file, b, nil
+}
+
+// lineHits returns the number of hits for each line in a file. Lines shared
+// by several blocks report the highest count.
+func lineHits(blocks []Block) map[int]int {
+	hits := make(map[int]int)
+	for _, b := range blocks {
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if n, ok := hits[l]; !ok || b.Count > n {
+				hits[l] = b.Count
+			}
+		}
+	}
+	return hits
+}
@@ -0,0 +1,220 @@
+// Package discover finds tests, benchmarks, examples, and fuzz targets by
+// parsing Go source, without compiling anything.
+package discover
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind distinguishes the different types of test functions.
+type Kind uint8
+
+// The go tool recognizes four kinds of test function.
+const (
+	KindUnknown Kind = iota
+	KindTest
+	KindBenchmark
+	KindExample
+	KindFuzz
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindTest:
+		return "test"
+	case KindBenchmark:
+		return "benchmark"
+	case KindExample:
+		return "example"
+	case KindFuzz:
+		return "fuzz"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// A Func is a single test function, or a subtest.
+type Func struct {
+	Kind Kind   `json:"kind"`
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Subtests lists the subtests started with literal names, like
+	// t.Run("empty", ...). Their names include their parents' names, as in
+	// "TestParse/empty".
+	Subtests []Func `json:"subtests,omitempty"`
+}
+
+// File parses a _test.go file and returns the test functions it declares, in
+// source order.
+func File(path string) ([]Func, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %q: %v", path, err)
+	}
+	var funcs []Func
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		kind := KindOf(f, fn)
+		if kind == KindUnknown {
+			continue
+		}
+		funcs = append(funcs, Func{
+			Kind:     kind,
+			Name:     fn.Name.Name,
+			File:     path,
+			Line:     fset.Position(fn.Pos()).Line,
+			Subtests: subtests(fset, path, kind, fn.Name.Name, fn.Body),
+		})
+	}
+	return funcs, nil
+}
+
+// subtests finds calls like t.Run("name", func(t *testing.T) { ... }) in a
+// function body, recursing into each subtest's body. Subtests with computed
+// names, as in table-driven tests, can't be found without running them.
+func subtests(fset *token.FileSet, path string, kind Kind, parent string, body *ast.BlockStmt) []Func {
+	if body == nil {
+		return nil
+	}
+	var subs []Func
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Run" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		fn, isFunc := call.Args[1].(*ast.FuncLit)
+		if !ok || lit.Kind != token.STRING || !isFunc {
+			return true
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		full := parent + "/" + subtestName(name)
+		subs = append(subs, Func{
+			Kind:     kind,
+			Name:     full,
+			File:     path,
+			Line:     fset.Position(call.Pos()).Line,
+			Subtests: subtests(fset, path, kind, full, fn.Body),
+		})
+		// The recursive call already covered the subtest's body.
+		return false
+	})
+	return subs
+}
+
+// subtestName rewrites a subtest name the way the testing package does,
+// replacing spaces with underscores.
+func subtestName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// KindOf reports what kind of test function a declaration in a file is,
+// applying the same rules as the go tool: the function name must have the
+// right prefix, and the parameters must have the right type. Examples must
+// also end with an output comment, since the go tool compiles but doesn't run
+// them otherwise, so the file must be parsed with parser.ParseComments. KindOf
+// doesn't check whether the function is a method.
+func KindOf(f *ast.File, fn *ast.FuncDecl) Kind {
+	name := fn.Name.Name
+	params := fn.Type.Params.List
+	switch {
+	case isTestName(name, "Example"):
+		if len(params) == 0 && fn.Type.Results == nil && hasOutput(f, fn.Body) {
+			return KindExample
+		}
+	case isTestName(name, "Test"):
+		if name != "TestMain" && hasParam(params, "T") {
+			return KindTest
+		}
+	case isTestName(name, "Benchmark"):
+		if hasParam(params, "B") {
+			return KindBenchmark
+		}
+	case isTestName(name, "Fuzz"):
+		if hasParam(params, "F") {
+			return KindFuzz
+		}
+	}
+	return KindUnknown
+}
+
+// isTestName reports whether name is prefix followed by nothing or by a
+// character that isn't a lower-case letter, so that "Testify" isn't a test.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// outputPrefix matches an example's output comment, as in go/doc.
+var outputPrefix = regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+
+// hasOutput reports whether the last comment in an example's body is an
+// output comment.
+func hasOutput(f *ast.File, body *ast.BlockStmt) bool {
+	if body == nil {
+		return false
+	}
+	var last *ast.CommentGroup
+	for _, cg := range f.Comments {
+		if cg.Pos() > body.Lbrace && cg.End() < body.Rbrace {
+			last = cg
+		}
+	}
+	return last != nil && outputPrefix.MatchString(last.Text())
+}
+
+// hasParam reports whether the parameter list is a single pointer to
+// testing.<typ>, however the testing package was imported.
+func hasParam(params []*ast.Field, typ string) bool {
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	switch x := star.X.(type) {
+	case *ast.SelectorExpr:
+		return x.Sel.Name == typ
+	case *ast.Ident:
+		// Dot-imported testing package.
+		return x.Name == typ
+	}
+	return false
+}
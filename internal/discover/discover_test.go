@@ -0,0 +1,42 @@
+package discover
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want Kind
+	}{
+		{"test", "func TestF(t *testing.T) {}", KindTest},
+		{"TestMain", "func TestMain(m *testing.M) {}", KindUnknown},
+		{"lower-case suffix", "func Testify(t *testing.T) {}", KindUnknown},
+		{"benchmark", "func BenchmarkF(b *testing.B) {}", KindBenchmark},
+		{"fuzz", "func FuzzF(f *testing.F) {}", KindFuzz},
+		{"example", "func ExampleF() {\n\tF()\n\t// Output: 1\n}", KindExample},
+		{"empty output", "func ExampleF() {\n\t// Output:\n}", KindExample},
+		{"unordered output", "func ExampleF() {\n\tF()\n\t// Unordered output:\n\t// 1\n\t// 2\n}", KindExample},
+		{"example without output", "func ExampleF() {\n\tF()\n}", KindUnknown},
+		{"output not last", "func ExampleF() {\n\t// Output: 1\n\tF()\n\t// done\n}", KindUnknown},
+		{"output outside body", "// Output: 1\nfunc ExampleF() {\n\tF()\n}", KindUnknown},
+		{"example with parameters", "func ExampleF(t *testing.T) {\n\t// Output:\n}", KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package p\n\nimport \"testing\"\n\n" + tt.src + "\n"
+			f, err := parser.ParseFile(token.NewFileSet(), "p_test.go", src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+			if got := KindOf(f, fn); got != tt.want {
+				t.Errorf("KindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
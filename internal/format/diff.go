@@ -0,0 +1,180 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change, as
+// in diff -u.
+const contextLines = 3
+
+// An edit is one line of an edit script: kept (' '), deleted ('-'), or
+// inserted ('+').
+type edit struct {
+	op   byte
+	line string
+}
+
+// Diff returns a unified diff from before to after, with the file labeled
+// a/name and b/name. It returns an empty string if the contents are equal.
+func Diff(name string, before, after []byte) string {
+	if bytes.Equal(before, after) {
+		return ""
+	}
+	edits := editScript(splitLines(before), splitLines(after))
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "--- a/%s\n+++ b/%s\n", name, name)
+	// oldLine and newLine are the zero-based line numbers before each edit.
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.op != '+' {
+			oldLine[i+1]++
+		}
+		if e.op != '-' {
+			newLine[i+1]++
+		}
+	}
+	for start := 0; start < len(edits); {
+		first := nextChange(edits, start)
+		if first == len(edits) {
+			break
+		}
+		// Extend the hunk while the next change is close enough that the
+		// context between them would overlap.
+		last := first
+		for {
+			next := nextChange(edits, last+1)
+			if next == len(edits) || next-last-1 > 2*contextLines {
+				break
+			}
+			last = next
+		}
+		from, to := first-contextLines, last+contextLines+1
+		if from < start {
+			from = start
+		}
+		if to > len(edits) {
+			to = len(edits)
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+			span(oldLine[from], oldLine[to]-oldLine[from]),
+			span(newLine[from], newLine[to]-newLine[from]))
+		for _, e := range edits[from:to] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return buf.String()
+}
+
+// nextChange returns the index of the first deletion or insertion at or
+// after i, or len(edits) if there isn't one.
+func nextChange(edits []edit, i int) int {
+	for i < len(edits) && edits[i].op == ' ' {
+		i++
+	}
+	return i
+}
+
+// span formats a hunk's range the way diff -u does: an empty range starts at
+// the line before it, and a single line omits the count.
+func span(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits src after each newline. The last line keeps no newline
+// if the file doesn't end with one.
+func splitLines(src []byte) []string {
+	var lines []string
+	for len(src) > 0 {
+		i := bytes.IndexByte(src, '\n') + 1
+		if i == 0 {
+			i = len(src)
+		}
+		lines = append(lines, string(src[:i]))
+		src = src[i:]
+	}
+	return lines
+}
+
+// editScript finds a shortest edit script from a to b with Myers'
+// algorithm, which is fast when the inputs are mostly the same.
+func editScript(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		// Backtracking from round d only reads diagonals -d-1 through d+1,
+		// so save just that part of the frontier.
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the saved frontiers from the end of both inputs back to
+// the start, recovering the edits.
+func backtrack(a, b []string, trace [][]int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, edit{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{'-', a[x]})
+		}
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,57 @@
+package format
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{
+			name:   "equal",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "replace",
+			before: "a\nb\nc\n",
+			after:  "a\nx\nc\n",
+			want:   "--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name:   "insert into empty file",
+			before: "",
+			after:  "a\n",
+			want:   "--- a/f.go\n+++ b/f.go\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name:   "add trailing newline",
+			before: "a\nb",
+			after:  "a\nb\n",
+			want:   "--- a/f.go\n+++ b/f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name:   "distant changes",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			after:  "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			want: "--- a/f.go\n+++ b/f.go\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n",
+		},
+		{
+			name:   "nearby changes share a hunk",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			after:  "x\n2\n3\n4\n5\n6\n7\ny\n",
+			want:   "--- a/f.go\n+++ b/f.go\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff("f.go", []byte(tt.before), []byte(tt.after)); got != tt.want {
+				t.Errorf("Diff(%q, %q) =\n%s\nwant\n%s", tt.before, tt.after, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package format groups imports and recognizes generated files, for the
+// parts of formatting that gofmt doesn't handle.
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generated matches the comment that marks generated files, as described in
+// https://golang.org/s/generatedcode.
+var generated = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// IsGenerated reports whether a file is marked as generated. The marker must
+// appear before the package clause.
+func IsGenerated(src []byte) bool {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil || !f.Package.IsValid() {
+		return generated.Match(src)
+	}
+	return generated.Match(src[:fset.Position(f.Package).Offset])
+}
+
+// Import groups, in the order they're written.
+const (
+	groupStandard = iota
+	groupThirdParty
+	groupLocal
+)
+
+// GroupImports sorts the imports in each parenthesized import declaration
+// into groups separated by blank lines: the standard library, then
+// third-party packages, then packages whose import paths start with one of
+// the local prefixes. Declarations with comments that don't belong to a
+// single import are left alone. The result still needs to be formatted.
+func GroupImports(filename string, src []byte, local []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(f.Pos())
+	out := bytes.NewBuffer(nil)
+	last := 0
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || !gd.Lparen.IsValid() || len(gd.Specs) == 0 {
+			continue
+		}
+		block, ok := groupBlock(tf, f, gd, src, local)
+		if !ok {
+			continue
+		}
+		start := tf.Offset(gd.Lparen) + 1
+		end := tf.Offset(gd.Rparen)
+		out.Write(src[last:start])
+		out.WriteString(block)
+		last = end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
+}
+
+// groupBlock returns the text between the parentheses of a grouped import
+// declaration.
+func groupBlock(tf *token.File, f *ast.File, gd *ast.GenDecl, src []byte, local []string) (string, bool) {
+	type entry struct {
+		path string
+		text string
+	}
+	attached := make(map[*ast.CommentGroup]bool)
+	var groups [3][]entry
+	for _, spec := range gd.Specs {
+		is := spec.(*ast.ImportSpec)
+		path, err := strconv.Unquote(is.Path.Value)
+		if err != nil || path == "C" {
+			return "", false
+		}
+		from, to := is.Pos(), is.End()
+		if is.Doc != nil {
+			from = is.Doc.Pos()
+			attached[is.Doc] = true
+		}
+		if is.Comment != nil {
+			to = is.Comment.End()
+			attached[is.Comment] = true
+		}
+		text := string(src[tf.Offset(from):tf.Offset(to)])
+		g := groupOf(path, local)
+		groups[g] = append(groups[g], entry{path: path, text: text})
+	}
+	for _, cg := range f.Comments {
+		if cg.Pos() > gd.Lparen && cg.End() < gd.Rparen && !attached[cg] {
+			return "", false
+		}
+	}
+
+	var blocks []string
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		sort.SliceStable(g, func(i, j int) bool { return g[i].path < g[j].path })
+		lines := make([]string, len(g))
+		for i, e := range g {
+			lines[i] = "\t" + e.text
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	return "\n" + strings.Join(blocks, "\n\n") + "\n", true
+}
+
+func groupOf(path string, local []string) int {
+	for _, prefix := range local {
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")) {
+			return groupLocal
+		}
+	}
+	first := path
+	if i := strings.Index(path, "/"); i >= 0 {
+		first = path[:i]
+	}
+	if strings.Contains(first, ".") {
+		return groupThirdParty
+	}
+	return groupStandard
+}
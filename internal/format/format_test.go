@@ -0,0 +1,215 @@
+package format
+
+import "testing"
+
+func TestGroupImports(t *testing.T) {
+	tests := []struct {
+		name  string
+		local []string
+		src   string
+		want  string
+	}{
+		{
+			name: "standard and third-party",
+			src: `package p
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"fmt"
+)
+`,
+			want: `package p
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+`,
+		},
+		{
+			name:  "local prefixes",
+			local: []string{"example.com/me/", "example.org/tool"},
+			src: `package p
+
+import (
+	"example.com/me/b"
+	"example.com/meter"
+	"example.org/tool"
+	"example.com/me/a"
+	"strings"
+)
+`,
+			want: `package p
+
+import (
+	"strings"
+
+	"example.com/meter"
+
+	"example.com/me/a"
+	"example.com/me/b"
+	"example.org/tool"
+)
+`,
+		},
+		{
+			name: "named imports sort by path",
+			src: `package p
+
+import (
+	z "fmt"
+	. "bytes"
+	_ "github.com/lib/pq"
+	a "github.com/akshayjshah/x"
+)
+`,
+			want: `package p
+
+import (
+	. "bytes"
+	z "fmt"
+
+	a "github.com/akshayjshah/x"
+	_ "github.com/lib/pq"
+)
+`,
+		},
+		{
+			name: "doc and trailing comments move with their imports",
+			src: `package p
+
+import (
+	"github.com/lib/pq" // for the driver
+	// fmt formats.
+	// It has two lines.
+	"fmt"
+)
+`,
+			want: `package p
+
+import (
+	// fmt formats.
+	// It has two lines.
+	"fmt"
+
+	"github.com/lib/pq" // for the driver
+)
+`,
+		},
+		{
+			name: "unattached comments",
+			src: `package p
+
+import (
+	"github.com/lib/pq"
+	"fmt"
+	// More to come.
+)
+`,
+			want: `package p
+
+import (
+	"github.com/lib/pq"
+	"fmt"
+	// More to come.
+)
+`,
+		},
+		{
+			name: "cgo",
+			src: `package p
+
+import (
+	"unsafe"
+	"C"
+)
+`,
+			want: `package p
+
+import (
+	"unsafe"
+	"C"
+)
+`,
+		},
+		{
+			name: "several declarations",
+			src: `// Package p does things.
+package p
+
+import "os"
+
+import (
+	"github.com/pkg/errors"
+	"fmt"
+)
+
+import (
+	"github.com/lib/pq"
+
+	// Unattached.
+
+	"bytes"
+
+	"strings"
+)
+
+import (
+	"io"
+	"example.com/x"
+)
+
+func f() {}
+`,
+			want: `// Package p does things.
+package p
+
+import "os"
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+import (
+	"github.com/lib/pq"
+
+	// Unattached.
+
+	"bytes"
+
+	"strings"
+)
+
+import (
+	"io"
+
+	"example.com/x"
+)
+
+func f() {}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GroupImports("p.go", []byte(tt.src), tt.local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GroupImports() returned\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupImportsSyntaxError(t *testing.T) {
+	if _, err := GroupImports("p.go", []byte("package p\n\nimport (\n\t\"fmt\"\n"), nil); err == nil {
+		t.Error("GroupImports() succeeded on a file with a syntax error")
+	}
+}
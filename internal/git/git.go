@@ -4,8 +4,12 @@ package git
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/akshayjshah/hardhat/internal/hhlog"
@@ -17,10 +21,49 @@ type Diff struct {
 	Modified []string
 }
 
+// A LineRange is an inclusive range of line numbers.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Contains reports whether the range includes the supplied line.
+func (lr LineRange) Contains(line int) bool {
+	return line >= lr.Start && line <= lr.End
+}
+
+// A Hunk describes one change in a file: OldLines lines starting at OldStart
+// were replaced by NewLines lines starting at NewStart. When a side has no
+// lines, as for a pure insertion or deletion, its start is the line just
+// before the change.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// Added returns the range of lines the hunk added, if any.
+func (h Hunk) Added() (LineRange, bool) {
+	if h.NewLines == 0 {
+		return LineRange{}, false
+	}
+	return LineRange{Start: h.NewStart, End: h.NewStart + h.NewLines - 1}, true
+}
+
+// Removed returns the range of lines the hunk removed, if any.
+func (h Hunk) Removed() (LineRange, bool) {
+	if h.OldLines == 0 {
+		return LineRange{}, false
+	}
+	return LineRange{Start: h.OldStart, End: h.OldStart + h.OldLines - 1}, true
+}
+
 // A Repository offers access to a handful of useful git commands.
 type Repository struct {
 	logger *hhlog.Logger
 	root   string
+	gitDir string
 }
 
 // New initializes and returns a Repository.
@@ -29,15 +72,21 @@ func New(logger *hhlog.Logger) (*Repository, error) {
 	if err := repo.setRoot(); err != nil {
 		return nil, err
 	}
+	if err := repo.setGitDir(); err != nil {
+		return nil, err
+	}
 	return repo, nil
 }
 
 // Root returns the absolute path to the repository root.
 func (r *Repository) Root() string { return r.root }
 
+// GitDir returns the absolute path to the repository's .git directory.
+func (r *Repository) GitDir() string { return r.gitDir }
+
 // Canonicalize converts the supplied commitish to a SHA1.
 func (r *Repository) Canonicalize(commitish string) (string, error) {
-	sha, err := r.run("rev-parse", commitish)
+	sha, err := r.run(r.Root(), "rev-parse", commitish)
 	if err != nil {
 		return "", fmt.Errorf("can't resolve %q to SHA1: %v", commitish, err)
 	}
@@ -95,6 +144,212 @@ func (r *Repository) Diff(since string) (Diff, error) {
 	return diff, nil
 }
 
+// ChangedLines returns the lines added or modified since the supplied
+// commitish, keyed by the path of the file relative to the repository root.
+// Every line of an untracked file counts as added.
+func (r *Repository) ChangedLines(since string) (map[string][]LineRange, error) {
+	hunks, err := r.Hunks(since)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string][]LineRange, len(hunks))
+	for file, hs := range hunks {
+		for _, h := range hs {
+			if lr, ok := h.Added(); ok {
+				changed[file] = append(changed[file], lr)
+			}
+		}
+	}
+	r.logger.Debugf("found changed lines in %d files since %q", len(changed), since)
+	return changed, nil
+}
+
+// Hunks returns the changes made since the supplied commitish, keyed by the
+// path of the file relative to the repository root. An untracked file is a
+// single hunk that adds every line.
+func (r *Repository) Hunks(since string) (map[string][]Hunk, error) {
+	out, err := r.run(
+		r.Root(),
+		"diff",
+		"--unified=0", // no context lines
+		"--no-color",
+		"--no-ext-diff",
+		"--src-prefix=a/", // override diff.noprefix and diff.mnemonicPrefix
+		"--dst-prefix=b/",
+		"--no-renames", // treat renames as a delete and an add
+		"--ignore-submodules",
+		since,
+		"--", // compare against working tree
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't diff against %q: %v", since, err)
+	}
+	hunks := parseHunks(out)
+
+	untracked, err := r.run(r.Root(), "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("can't find untracked files: %v", err)
+	}
+	for _, u := range strings.Split(untracked, "\n") {
+		if u == "" {
+			continue
+		}
+		bs, err := ioutil.ReadFile(filepath.Join(r.Root(), u))
+		if err != nil {
+			return nil, fmt.Errorf("can't read untracked file %q: %v", u, err)
+		}
+		if lines := countLines(bs); lines > 0 {
+			hunks[u] = []Hunk{{NewStart: 1, NewLines: lines}}
+		}
+	}
+	return hunks, nil
+}
+
+// Dirty reports whether the working tree has uncommitted changes, including
+// untracked files.
+func (r *Repository) Dirty() (bool, error) {
+	out, err := r.run(r.Root(), "status", "--porcelain")
+	if err != nil {
+		return false, fmt.Errorf("can't check working tree status: %v", err)
+	}
+	return out != "", nil
+}
+
+// MergeBase returns the SHA1 of the best common ancestor of two commits.
+func (r *Repository) MergeBase(a, b string) (string, error) {
+	sha, err := r.run(r.Root(), "merge-base", a, b)
+	if err != nil {
+		return "", fmt.Errorf("can't find merge base of %q and %q: %v", a, b, err)
+	}
+	return sha, nil
+}
+
+// Describe names HEAD after the most recent reachable tag, falling back to an
+// abbreviated SHA1 if there aren't any tags.
+func (r *Repository) Describe() (string, error) {
+	out, err := r.run(r.Root(), "describe", "--tags", "--always")
+	if err != nil {
+		return "", fmt.Errorf("can't describe HEAD: %v", err)
+	}
+	return out, nil
+}
+
+// Branch returns the name of the current branch, or an empty string if HEAD
+// is detached.
+func (r *Repository) Branch() (string, error) {
+	out, err := r.run(r.Root(), "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("can't find current branch: %v", err)
+	}
+	if out == "HEAD" {
+		return "", nil
+	}
+	return out, nil
+}
+
+// AddWorktree checks out the supplied commitish into a new, detached working
+// tree in dir.
+func (r *Repository) AddWorktree(dir, commitish string) error {
+	if _, err := r.run(r.Root(), "worktree", "add", "--detach", dir, commitish); err != nil {
+		return fmt.Errorf("can't check out %q in %q: %v", commitish, dir, err)
+	}
+	r.logger.Debugf("checked out %q in worktree %q", commitish, dir)
+	return nil
+}
+
+// RemoveWorktree deletes a working tree created by AddWorktree.
+func (r *Repository) RemoveWorktree(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if _, err := r.run(r.Root(), "worktree", "prune"); err != nil {
+		return fmt.Errorf("can't prune worktrees: %v", err)
+	}
+	return nil
+}
+
+// Exists reports whether a file or directory, relative to the repository
+// root, existed as of the supplied commitish.
+func (r *Repository) Exists(commitish, path string) bool {
+	if path == "." {
+		path = ""
+	}
+	_, err := r.run(r.Root(), "cat-file", "-e", commitish+":"+filepath.ToSlash(path))
+	return err == nil
+}
+
+// Show returns the contents of a file, relative to the repository root, as of
+// the supplied commitish. If the file didn't exist then, it returns nil.
+func (r *Repository) Show(commitish, path string) ([]byte, error) {
+	if !r.Exists(commitish, path) {
+		return nil, nil
+	}
+	spec := commitish + ":" + filepath.ToSlash(path)
+	cmd := exec.Command("git", "show", spec)
+	cmd.Dir = r.Root()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't read %q as of %q: %v", path, commitish, err)
+	}
+	return out, nil
+}
+
+// countLines counts the lines in a file, including a final line without a
+// trailing newline.
+func countLines(bs []byte) int {
+	lines := bytes.Count(bs, []byte("\n"))
+	if len(bs) > 0 && bs[len(bs)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// parseHunks extracts the hunks from the output of git diff --unified=0.
+func parseHunks(diff string) map[string][]Hunk {
+	hunks := make(map[string][]Hunk)
+	var file string
+	// body counts the lines left in the current hunk, which may look like
+	// headers: an added line "++ x" is printed as "+++ x".
+	body := 0
+	for _, line := range strings.Split(diff, "\n") {
+		if body > 0 && len(line) > 0 && strings.ContainsRune("+- ", rune(line[0])) {
+			body--
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if strings.HasPrefix(line, "+++ b/") {
+				file = strings.TrimPrefix(line, "+++ b/")
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			// @@ -old[,count] +new[,count] @@
+			fields := strings.Fields(line)
+			if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+				continue
+			}
+			var h Hunk
+			h.OldStart, h.OldLines = parseSpan(strings.TrimPrefix(fields[1], "-"))
+			h.NewStart, h.NewLines = parseSpan(strings.TrimPrefix(fields[2], "+"))
+			hunks[file] = append(hunks[file], h)
+			body = h.OldLines + h.NewLines
+		}
+	}
+	return hunks
+}
+
+// parseSpan parses one side of a hunk header, like "12,3" or "12". The count
+// defaults to one.
+func parseSpan(spec string) (start, count int) {
+	count = 1
+	if i := strings.Index(spec, ","); i >= 0 {
+		count, _ = strconv.Atoi(spec[i+1:])
+		spec = spec[:i]
+	}
+	start, _ = strconv.Atoi(spec)
+	return start, count
+}
+
 // All returns all files in the repository, including untracked files,
 // relative to the repository root.
 func (r *Repository) All() (Diff, error) {
@@ -119,6 +374,30 @@ func (r *Repository) All() (Diff, error) {
 	return diff, nil
 }
 
+// ChangeCounts returns the number of times each file was modified in the
+// most recent commits, with paths relative to the repository root.
+func (r *Repository) ChangeCounts(commits int) (map[string]int, error) {
+	out, err := r.run(
+		r.Root(),
+		"log",
+		fmt.Sprintf("--max-count=%d", commits),
+		"--name-only",
+		"--format=", // omit everything but the file names
+		"--no-renames",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't count changes to files: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, f := range strings.Split(out, "\n") {
+		if f != "" {
+			counts[f]++
+		}
+	}
+	r.logger.Debugf("found %d files changed in the last %d commits", len(counts), commits)
+	return counts, nil
+}
+
 func (r *Repository) setRoot() error {
 	root, err := r.run("", "rev-parse", "--show-toplevel")
 	if err != nil {
@@ -129,6 +408,19 @@ func (r *Repository) setRoot() error {
 	return nil
 }
 
+func (r *Repository) setGitDir() error {
+	dir, err := r.run(r.Root(), "rev-parse", "--git-dir")
+	if err != nil {
+		return fmt.Errorf("can't find .git directory: %v", err)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(r.Root(), dir)
+	}
+	r.logger.Debugf("git directory is %q", dir)
+	r.gitDir = dir
+	return nil
+}
+
 func (r *Repository) run(cwd string, subcommand ...string) (string, error) {
 	out := bytes.NewBuffer(nil)
 	cmd := exec.Command("git", subcommand...)
@@ -0,0 +1,105 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHunks(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want map[string][]Hunk
+	}{
+		{
+			name: "counts",
+			diff: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -3,2 +3,4 @@ func A() {\n-x\n-y\n+x\n+y\n+z\n+w\n",
+			want: map[string][]Hunk{"a.go": {{OldStart: 3, OldLines: 2, NewStart: 3, NewLines: 4}}},
+		},
+		{
+			name: "pure insertion",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -3,0 +4,2 @@\n+x\n+y\n",
+			want: map[string][]Hunk{"a.go": {{OldStart: 3, OldLines: 0, NewStart: 4, NewLines: 2}}},
+		},
+		{
+			name: "pure deletion",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -5,2 +4,0 @@\n-x\n-y\n",
+			want: map[string][]Hunk{"a.go": {{OldStart: 5, OldLines: 2, NewStart: 4, NewLines: 0}}},
+		},
+		{
+			name: "omitted counts",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -7 +11 @@\n-x\n+y\n",
+			want: map[string][]Hunk{"a.go": {{OldStart: 7, OldLines: 1, NewStart: 11, NewLines: 1}}},
+		},
+		{
+			name: "no newline at end of file",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -9 +9,2 @@\n-}\n\\ No newline at end of file\n+}\n+// x\n\\ No newline at end of file\n",
+			want: map[string][]Hunk{"a.go": {{OldStart: 9, OldLines: 1, NewStart: 9, NewLines: 2}}},
+		},
+		{
+			name: "several files",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-x\n+y\n@@ -8,0 +9 @@\n+z\n" +
+				"--- a/dir/b.go\n+++ b/dir/b.go\n@@ -2,3 +1,0 @@\n-x\n-y\n-z\n",
+			want: map[string][]Hunk{
+				"a.go": {
+					{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1},
+					{OldStart: 8, OldLines: 0, NewStart: 9, NewLines: 1},
+				},
+				"dir/b.go": {{OldStart: 2, OldLines: 3, NewStart: 1, NewLines: 0}},
+			},
+		},
+		{
+			name: "lines that look like headers",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -2 +2,2 @@\n--- x\n+++ y\n+++ b/z\n@@ -9 +10 @@\n-x\n+y\n",
+			want: map[string][]Hunk{"a.go": {
+				{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 2},
+				{OldStart: 9, OldLines: 1, NewStart: 10, NewLines: 1},
+			}},
+		},
+		{
+			name: "deleted file",
+			diff: "--- a/a.go\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+			want: map[string][]Hunk{},
+		},
+		{
+			name: "file name with diff markers",
+			diff: "--- a/+++ b/x.go\n+++ b/+++ b/x.go\n@@ -1 +1 @@\n-x\n+y\n",
+			want: map[string][]Hunk{"+++ b/x.go": {{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHunks(tt.diff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHunks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkRanges(t *testing.T) {
+	h := Hunk{OldStart: 5, OldLines: 2, NewStart: 4, NewLines: 0}
+	if r, ok := h.Removed(); !ok || r != (LineRange{Start: 5, End: 6}) {
+		t.Errorf("Removed() = %v, %v, want {5 6}, true", r, ok)
+	}
+	if _, ok := h.Added(); ok {
+		t.Errorf("Added() reported lines for a pure deletion")
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"", 0},
+		{"\n", 1},
+		{"a\nb\n", 2},
+		{"a\nb", 2},
+		{"a", 1},
+	}
+	for _, tt := range tests {
+		if got := countLines([]byte(tt.src)); got != tt.want {
+			t.Errorf("countLines(%q) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
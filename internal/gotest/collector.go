@@ -0,0 +1,209 @@
+package gotest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Event is a single line of "go test -json" output. See "go doc
+// test2json" for details.
+type Event struct {
+	Time       time.Time
+	Action     string
+	Package    string
+	ImportPath string // only set for build events
+	Test       string
+	Elapsed    float64 // seconds
+	Output     string
+}
+
+type testKey struct {
+	pkg, test string
+}
+
+// A Collector assembles a Report from a stream of test events. As it
+// consumes events, it echoes their output in roughly the same format as "go
+// test" would have used without the -json flag.
+type Collector struct {
+	mu      sync.Mutex
+	out     io.Writer
+	verbose bool
+	prefix  bool // prefix each line of output with its package
+
+	pkgs    map[string]*PackageResult
+	tests   map[testKey]*TestResult
+	pending map[testKey]*bytes.Buffer
+}
+
+// NewCollector constructs a Collector that echoes output to the supplied
+// writer. Unless the collector is verbose, output from passing tests is
+// discarded.
+func NewCollector(out io.Writer, verbose bool) *Collector {
+	return &Collector{
+		out:     out,
+		verbose: verbose,
+		pkgs:    make(map[string]*PackageResult),
+		tests:   make(map[testKey]*TestResult),
+		pending: make(map[testKey]*bytes.Buffer),
+	}
+}
+
+// Scan reads events from the supplied reader until it's exhausted, passing
+// each one to a callback. Lines that aren't JSON-encoded events are passed to
+// the other callback.
+func Scan(r io.Reader, event func(Event), other func(line []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e Event
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &e) != nil {
+			other(line)
+			continue
+		}
+		event(e)
+	}
+	return scanner.Err()
+}
+
+// Consume reads events from the supplied reader until it's exhausted. Lines
+// that aren't JSON-encoded events are echoed unchanged.
+func (c *Collector) Consume(r io.Reader) error {
+	return c.consume(r, "")
+}
+
+// consume is like Consume, but labels non-JSON lines with the supplied
+// package.
+func (c *Collector) consume(r io.Reader, label string) error {
+	return Scan(r, c.Add, func(line []byte) {
+		c.echo(label, string(line)+"\n")
+	})
+}
+
+// echo writes output that isn't associated with any event.
+func (c *Collector) echo(pkg, output string) {
+	c.mu.Lock()
+	c.write(pkg, output)
+	c.mu.Unlock()
+}
+
+// write echoes output, adding a prefix if necessary. Callers must hold the
+// lock.
+func (c *Collector) write(pkg, output string) {
+	if !c.prefix || pkg == "" {
+		io.WriteString(c.out, output)
+		return
+	}
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line != "" {
+			fmt.Fprintf(c.out, "%s | %s", pkg, line)
+		}
+	}
+}
+
+// Add processes a single event.
+func (c *Collector) Add(e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.Package == "" {
+		// Build output and other package-less events.
+		c.write(e.ImportPath, e.Output)
+		return
+	}
+	pkg, ok := c.pkgs[e.Package]
+	if !ok {
+		pkg = &PackageResult{Path: e.Package}
+		c.pkgs[e.Package] = pkg
+	}
+
+	if e.Test == "" {
+		c.addPackageEvent(pkg, e)
+		return
+	}
+	key := testKey{e.Package, e.Test}
+	t, ok := c.tests[key]
+	if !ok {
+		t = &TestResult{Name: e.Test}
+		c.tests[key] = t
+		pkg.Tests = append(pkg.Tests, t)
+	}
+	c.addTestEvent(key, t, e)
+}
+
+// Report returns the results collected so far, sorted by package.
+func (c *Collector) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := Report{Packages: make([]*PackageResult, 0, len(c.pkgs))}
+	for _, pkg := range c.pkgs {
+		r.Packages = append(r.Packages, pkg)
+	}
+	r.sort()
+	return r
+}
+
+func (c *Collector) addPackageEvent(pkg *PackageResult, e Event) {
+	switch e.Action {
+	case "output":
+		if !c.verbose && (e.Output == "PASS\n" || e.Output == "FAIL\n") {
+			// Without -v, go test only prints the summary line.
+			return
+		}
+		c.write(pkg.Path, e.Output)
+	case "pass", "fail", "skip":
+		pkg.Result = parseResult(e.Action)
+		pkg.Elapsed = seconds(e.Elapsed)
+	}
+}
+
+func (c *Collector) addTestEvent(key testKey, t *TestResult, e Event) {
+	switch e.Action {
+	case "output":
+		if c.verbose {
+			c.write(key.pkg, e.Output)
+		}
+		if isProgress(e.Output) {
+			return
+		}
+		buf, ok := c.pending[key]
+		if !ok {
+			buf = bytes.NewBuffer(nil)
+			c.pending[key] = buf
+		}
+		buf.WriteString(e.Output)
+	case "pass", "fail", "skip":
+		t.Result = parseResult(e.Action)
+		t.Elapsed = seconds(e.Elapsed)
+		buf := c.pending[key]
+		delete(c.pending, key)
+		if t.Result != ResultFail || buf == nil {
+			return
+		}
+		t.Output = buf.String()
+		if !c.verbose {
+			c.write(key.pkg, t.Output)
+		}
+	}
+}
+
+// isProgress reports whether a line of output is one of the progress markers
+// that go test adds in verbose mode.
+func isProgress(line string) bool {
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,128 @@
+package gotest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName  string        `xml:"classname,attr"`
+	Name       string        `xml:"name,attr"`
+	Time       string        `xml:"time,attr"`
+	Properties *junitProps   `xml:"properties,omitempty"`
+	Failure    *junitMessage `xml:"failure,omitempty"`
+	Skipped    *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitProps struct {
+	Properties []junitProp `xml:"property"`
+}
+
+type junitProp struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report in the JUnit XML format understood by most CI
+// systems. Each package becomes a test suite, and each benchmark regression
+// becomes a failed test case in its package's suite.
+func (r Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{Suites: make([]junitSuite, 0, len(r.Packages))}
+	for _, p := range r.Packages {
+		suites.Suites = append(suites.Suites, junitPackage(p))
+	}
+	for _, reg := range r.Regressions {
+		i := 0
+		for i < len(suites.Suites) && suites.Suites[i].Name != reg.Package {
+			i++
+		}
+		if i == len(suites.Suites) {
+			suites.Suites = append(suites.Suites, junitSuite{Name: reg.Package, Time: junitTime(0)})
+		}
+		s := &suites.Suites[i]
+		s.Tests++
+		s.Failures++
+		s.Cases = append(s.Cases, junitCase{
+			ClassName: reg.Package,
+			Name:      fmt.Sprintf("%s (%s)", reg.Benchmark, reg.Unit),
+			Time:      junitTime(0),
+			Failure: &junitMessage{
+				Message: fmt.Sprintf("Regressed by %+.2f%%", reg.Delta),
+				Body:    fmt.Sprintf("old %g %s, new %g %s (p=%.3f)", reg.Old, reg.Unit, reg.New, reg.Unit, reg.P),
+			},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitPackage(p *PackageResult) junitSuite {
+	s := junitSuite{
+		Name:  p.Path,
+		Tests: len(p.Tests),
+		Time:  junitTime(p.Elapsed),
+		Cases: make([]junitCase, 0, len(p.Tests)),
+	}
+	for _, t := range p.Tests {
+		c := junitCase{
+			ClassName: p.Path,
+			Name:      t.Name,
+			Time:      junitTime(t.Elapsed),
+		}
+		switch {
+		case t.Result == ResultFail && t.Quarantined:
+			s.Skipped++
+			c.Skipped = &junitMessage{Message: "Failed, but quarantined", Body: t.Output}
+		case t.Result == ResultFail:
+			s.Failures++
+			c.Failure = &junitMessage{Message: "Failed", Body: t.Output}
+		case t.Result == ResultSkip:
+			s.Skipped++
+			c.Skipped = &junitMessage{Message: "Skipped"}
+		}
+		if t.Flaky {
+			c.Properties = &junitProps{[]junitProp{{Name: "flaky", Value: "true"}}}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	if p.Result == ResultFail && len(p.Failed()) == 0 {
+		// The package failed without any failing tests, which usually means
+		// that it didn't compile or that TestMain failed.
+		s.Errors++
+	}
+	return s
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,234 @@
+// Package gotest parses the output of "go test -json" into a structured
+// report.
+package gotest
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Result describes the outcome of a test or package.
+type Result uint8
+
+// Each test or package passes, fails, or is skipped.
+const (
+	ResultUnknown Result = iota
+	ResultPass
+	ResultFail
+	ResultSkip
+)
+
+func (r Result) String() string {
+	switch r {
+	case ResultPass:
+		return "pass"
+	case ResultFail:
+		return "fail"
+	case ResultSkip:
+		return "skip"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r Result) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func parseResult(action string) Result {
+	switch action {
+	case "pass":
+		return ResultPass
+	case "fail":
+		return ResultFail
+	case "skip":
+		return ResultSkip
+	default:
+		return ResultUnknown
+	}
+}
+
+// A TestResult describes a single test, benchmark, or example.
+type TestResult struct {
+	Name    string        `json:"name"`
+	Result  Result        `json:"result"`
+	Elapsed time.Duration `json:"elapsed"`
+	Flaky   bool          `json:"flaky,omitempty"`
+	// Quarantined tests are known to be flaky, so their failures don't fail
+	// the run.
+	Quarantined bool   `json:"quarantined,omitempty"`
+	Output      string `json:"output,omitempty"`
+}
+
+// A PackageResult describes a single package's test run.
+type PackageResult struct {
+	Path    string        `json:"path"`
+	Result  Result        `json:"result"`
+	Elapsed time.Duration `json:"elapsed"`
+	Tests   []*TestResult `json:"tests"`
+}
+
+// Failed returns the tests in the package that failed.
+func (p *PackageResult) Failed() []*TestResult {
+	var failed []*TestResult
+	for _, t := range p.Tests {
+		if t.Result == ResultFail {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// failedOutsideQuarantine reports whether the package failed for any reason
+// other than quarantined tests.
+func (p *PackageResult) failedOutsideQuarantine() bool {
+	if p.Result != ResultFail {
+		return false
+	}
+	failed := p.Failed()
+	if len(failed) == 0 {
+		return true
+	}
+	for _, t := range failed {
+		if !t.Quarantined {
+			return true
+		}
+	}
+	return false
+}
+
+// A Report collects the results of a test run.
+type Report struct {
+	Packages []*PackageResult `json:"packages"`
+	// Skipped lists packages that weren't tested at all.
+	Skipped []SkippedPackage `json:"skipped,omitempty"`
+	// Regressions lists benchmarks that got significantly slower or started
+	// allocating more.
+	Regressions []Regression `json:"regressions,omitempty"`
+}
+
+// A Regression is a benchmark measurement that got significantly worse
+// compared to a baseline.
+type Regression struct {
+	Package   string  `json:"package"`
+	Benchmark string  `json:"benchmark"`
+	Unit      string  `json:"unit"`
+	Old       float64 `json:"old"`
+	New       float64 `json:"new"`
+	// Delta is the change as a percentage of the old value.
+	Delta float64 `json:"delta"`
+	P     float64 `json:"p"`
+}
+
+// A SkippedPackage is a package that wasn't tested, along with the reason
+// why.
+type SkippedPackage struct {
+	Package string `json:"package"`
+	Reason  string `json:"reason"`
+}
+
+// Failed reports whether any package in the run failed or any benchmark
+// regressed. Packages that failed only because of quarantined tests don't
+// count.
+func (r Report) Failed() bool {
+	if len(r.Regressions) > 0 {
+		return true
+	}
+	for _, p := range r.Packages {
+		if p.failedOutsideQuarantine() {
+			return true
+		}
+	}
+	return false
+}
+
+// Package returns the result for the named package, or nil if the package
+// isn't part of the report.
+func (r Report) Package(path string) *PackageResult {
+	for _, p := range r.Packages {
+		if p.Path == path {
+			return p
+		}
+	}
+	return nil
+}
+
+// A QuarantinedTest identifies a quarantined test that failed.
+type QuarantinedTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+}
+
+// Quarantine marks the failed tests selected by the supplied function as
+// quarantined. Since a failing subtest also fails its parent, a parent is
+// quarantined too if every failed subtest under it is and it has no failure
+// output of its own.
+func (r Report) Quarantine(quarantined func(pkg, test string) bool) {
+	for _, p := range r.Packages {
+		failed := p.Failed()
+		for _, t := range failed {
+			if quarantined(p.Path, t.Name) {
+				t.Quarantined = true
+			}
+		}
+		// Visit the most deeply nested tests first, so that a parent sees its
+		// subtests' final state.
+		sort.SliceStable(failed, func(i, j int) bool {
+			return strings.Count(failed[i].Name, "/") > strings.Count(failed[j].Name, "/")
+		})
+		for _, t := range failed {
+			if !t.Quarantined && hasOnlyFrames(t.Output) {
+				t.Quarantined = subtestsQuarantined(failed, t.Name)
+			}
+		}
+	}
+}
+
+// subtestsQuarantined reports whether a test has failed subtests, all of
+// which are quarantined.
+func subtestsQuarantined(failed []*TestResult, parent string) bool {
+	found := false
+	for _, t := range failed {
+		if !strings.HasPrefix(t.Name, parent+"/") {
+			continue
+		}
+		if !t.Quarantined {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// hasOnlyFrames reports whether a test's output consists only of the status
+// lines go test prints for it and its subtests, like "--- FAIL: TestFoo".
+func hasOnlyFrames(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--- ") {
+			return false
+		}
+	}
+	return true
+}
+
+// Quarantined returns the quarantined tests that failed.
+func (r Report) Quarantined() []QuarantinedTest {
+	var quarantined []QuarantinedTest
+	for _, p := range r.Packages {
+		for _, t := range p.Failed() {
+			if t.Quarantined {
+				quarantined = append(quarantined, QuarantinedTest{Package: p.Path, Test: t.Name})
+			}
+		}
+	}
+	return quarantined
+}
+
+func (r Report) sort() {
+	sort.Slice(r.Packages, func(i, j int) bool {
+		return r.Packages[i].Path < r.Packages[j].Path
+	})
+}
@@ -0,0 +1,73 @@
+package gotest
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A FlakyTest identifies a test that failed and then passed when retried.
+type FlakyTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+}
+
+// FailedPattern returns an anchored regexp, suitable for go test's -run flag,
+// that matches the top-level tests that failed in the package. If no tests
+// failed, it returns an empty string.
+func (p *PackageResult) FailedPattern() string {
+	var names []string
+	for _, t := range p.Failed() {
+		if !strings.Contains(t.Name, "/") {
+			names = append(names, regexp.QuoteMeta(t.Name))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return "^(" + strings.Join(names, "|") + ")$"
+}
+
+// Merge folds the results of a retry into the package's results. Tests that
+// originally failed but passed on retry are marked flaky. If every test now
+// passes and the retried package passed, the package passes too.
+func (p *PackageResult) Merge(retry *PackageResult) {
+	byName := make(map[string]*TestResult, len(p.Tests))
+	for _, t := range p.Tests {
+		byName[t.Name] = t
+	}
+	for _, rt := range retry.Tests {
+		t, ok := byName[rt.Name]
+		if !ok {
+			p.Tests = append(p.Tests, rt)
+			continue
+		}
+		if t.Result != ResultFail {
+			continue
+		}
+		switch rt.Result {
+		case ResultPass:
+			t.Result = ResultPass
+			t.Flaky = true
+		case ResultFail:
+			t.Output = rt.Output
+		}
+	}
+	if len(p.Failed()) == 0 && retry.Result == ResultPass {
+		p.Result = ResultPass
+	}
+}
+
+// Flaky returns the tests in the report that passed only after a retry.
+func (r Report) Flaky() []FlakyTest {
+	var flaky []FlakyTest
+	for _, p := range r.Packages {
+		for _, t := range p.Tests {
+			if t.Flaky {
+				flaky = append(flaky, FlakyTest{Package: p.Path, Test: t.Name})
+			}
+		}
+	}
+	return flaky
+}
@@ -0,0 +1,134 @@
+package gotest
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// A Job is a single go test invocation.
+type Job struct {
+	Packages []string
+	// Args are flags specific to this invocation, like -run.
+	Args []string
+}
+
+// A Runner schedules go test invocations across a pool of workers, merging
+// their results into a single report.
+type Runner struct {
+	// Command constructs the command for a single invocation of the go tool.
+	Command func(args ...string) *exec.Cmd
+	// Args are flags passed to every invocation. The Runner adds -json
+	// itself.
+	Args    []string
+	Workers int
+	// If FailFast is set, the Runner stops starting new jobs after the first
+	// failure. Jobs that are already running are allowed to finish.
+	FailFast bool
+	Verbose  bool
+	Out      io.Writer
+}
+
+// Run executes the supplied jobs. Output is streamed as it's produced; if
+// more than one job can run at once, each line is prefixed with the name of
+// the package that produced it.
+func (r *Runner) Run(jobs []Job) (Report, error) {
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	c := NewCollector(r.Out, r.Verbose)
+	c.prefix = workers > 1
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		stopped  bool
+		skipped  []SkippedPackage
+		wg       sync.WaitGroup
+	)
+	queue := make(chan Job)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				mu.Lock()
+				if stopped {
+					for _, pkg := range job.Packages {
+						skipped = append(skipped, SkippedPackage{Package: pkg, Reason: "fail-fast"})
+					}
+					mu.Unlock()
+					continue
+				}
+				mu.Unlock()
+
+				err := r.invoke(c, job)
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				stopped = stopped || r.FailFast
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	report := c.Report()
+	report.Skipped = skipped
+	return report, firstErr
+}
+
+func (r *Runner) invoke(c *Collector, job Job) error {
+	args := append([]string{"test", "-json"}, r.Args...)
+	if r.FailFast {
+		args = append(args, "-failfast")
+	}
+	args = append(args, job.Args...)
+	args = append(args, job.Packages...)
+	cmd := r.Command(args...)
+
+	label := ""
+	if len(job.Packages) > 0 {
+		label = job.Packages[0]
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("can't run go test: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Scan(stderr, func(e Event) {
+			c.echo(label, e.Output)
+		}, func(line []byte) {
+			c.echo(label, string(line)+"\n")
+		})
+	}()
+	consumeErr := c.consume(stdout, label)
+	<-done
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return consumeErr
+}
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/bench"
+)
+
+const benchmarksFile = "benchmarks.json"
+
+// Keep results for this many commits.
+const maxBaselines = 50
+
+// A BenchmarkRun collects the benchmark results measured at a single commit.
+type BenchmarkRun struct {
+	Commit  string            `json:"commit"`
+	Time    time.Time         `json:"time"`
+	Samples []BenchmarkSample `json:"samples"`
+}
+
+// A BenchmarkSample is a set of measurements of a single benchmark.
+type BenchmarkSample struct {
+	Package string    `json:"package"`
+	Name    string    `json:"name"`
+	Unit    string    `json:"unit"`
+	Values  []float64 `json:"values"`
+}
+
+// Benchmarks records benchmark results for recent commits, so that they can
+// serve as baselines.
+type Benchmarks struct {
+	Runs []*BenchmarkRun `json:"runs"`
+}
+
+// Benchmarks loads the stored benchmark results.
+func (s *Store) Benchmarks() (*Benchmarks, error) {
+	b := &Benchmarks{}
+	if err := s.read(benchmarksFile, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SaveBenchmarks persists the supplied benchmark results.
+func (s *Store) SaveBenchmarks(b *Benchmarks) error {
+	return s.write(benchmarksFile, b)
+}
+
+// Record adds results measured at the supplied commit. Results for a
+// benchmark replace any previously recorded at the same commit.
+func (b *Benchmarks) Record(commit string, samples bench.Samples, at time.Time) {
+	run := b.find(commit)
+	if run == nil {
+		run = &BenchmarkRun{Commit: commit}
+		b.Runs = append(b.Runs, run)
+	}
+	run.Time = at
+	for k, units := range samples {
+		for unit, values := range units {
+			sample := BenchmarkSample{Package: k.Package, Name: k.Name, Unit: unit, Values: values}
+			replaced := false
+			for i, existing := range run.Samples {
+				if existing.Package == k.Package && existing.Name == k.Name && existing.Unit == unit {
+					run.Samples[i] = sample
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				run.Samples = append(run.Samples, sample)
+			}
+		}
+	}
+	sort.Slice(b.Runs, func(i, j int) bool {
+		return b.Runs[i].Time.After(b.Runs[j].Time)
+	})
+	if len(b.Runs) > maxBaselines {
+		b.Runs = b.Runs[:maxBaselines]
+	}
+}
+
+// Samples returns the results recorded at the supplied commit, or nil if
+// there are none.
+func (b *Benchmarks) Samples(commit string) bench.Samples {
+	run := b.find(commit)
+	if run == nil {
+		return nil
+	}
+	samples := make(bench.Samples)
+	for _, s := range run.Samples {
+		k := bench.Key{Package: s.Package, Name: s.Name}
+		if samples[k] == nil {
+			samples[k] = make(map[string][]float64)
+		}
+		samples[k][s.Unit] = s.Values
+	}
+	return samples
+}
+
+func (b *Benchmarks) find(commit string) *BenchmarkRun {
+	for _, run := range b.Runs {
+		if run.Commit == commit {
+			return run
+		}
+	}
+	return nil
+}
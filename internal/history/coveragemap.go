@@ -0,0 +1,169 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/cover"
+	"github.com/akshayjshah/hardhat/internal/git"
+)
+
+const coverageMapFile = "coverage-map.json"
+
+// A TestID identifies a single top-level test.
+type TestID struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+}
+
+// A CoveredRange is a range of executable lines, along with the tests that
+// executed them. Tests are identified by their index in the map's list of
+// tests.
+type CoveredRange struct {
+	Start int   `json:"start"`
+	End   int   `json:"end"`
+	Tests []int `json:"tests,omitempty"`
+}
+
+// A CoverageMap records which tests execute each range of lines in the
+// project. Files are identified by their path relative to the repository
+// root.
+type CoverageMap struct {
+	Commit string                    `json:"commit"`
+	Built  time.Time                 `json:"built"`
+	Tests  []TestID                  `json:"tests"`
+	Files  map[string][]CoveredRange `json:"files"`
+
+	index map[string]map[git.LineRange]map[int]struct{}
+}
+
+// NewCoverageMap constructs an empty coverage map for the supplied commit.
+func NewCoverageMap(commit string, built time.Time) *CoverageMap {
+	return &CoverageMap{
+		Commit: commit,
+		Built:  built,
+		Files:  make(map[string][]CoveredRange),
+		index:  make(map[string]map[git.LineRange]map[int]struct{}),
+	}
+}
+
+// CoverageMap loads the stored coverage map. If no map has been built, it
+// returns nil.
+func (s *Store) CoverageMap() (*CoverageMap, error) {
+	var m CoverageMap
+	if err := s.read(coverageMapFile, &m); err != nil {
+		return nil, err
+	}
+	if m.Files == nil {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// SaveCoverageMap persists the supplied coverage map.
+func (s *Store) SaveCoverageMap(m *CoverageMap) error {
+	m.finish()
+	return s.write(coverageMapFile, m)
+}
+
+// Add records the coverage of a single test. Every instrumented block is
+// recorded, even if the test didn't execute it, so that the map knows which
+// lines are executable.
+func (m *CoverageMap) Add(test TestID, p *cover.Profile, filename func(string) string) {
+	id := len(m.Tests)
+	m.Tests = append(m.Tests, test)
+	for _, file := range p.Files() {
+		name := filename(file)
+		ranges, ok := m.index[name]
+		if !ok {
+			ranges = make(map[git.LineRange]map[int]struct{})
+			m.index[name] = ranges
+		}
+		for _, b := range p.Blocks(file) {
+			lr := git.LineRange{Start: b.StartLine, End: b.EndLine}
+			tests, ok := ranges[lr]
+			if !ok {
+				tests = make(map[int]struct{})
+				ranges[lr] = tests
+			}
+			if b.Count > 0 {
+				tests[id] = struct{}{}
+			}
+		}
+	}
+}
+
+// finish converts the index built by Add into the serializable form.
+func (m *CoverageMap) finish() {
+	for file, ranges := range m.index {
+		crs := make([]CoveredRange, 0, len(ranges))
+		for lr, tests := range ranges {
+			cr := CoveredRange{Start: lr.Start, End: lr.End}
+			for id := range tests {
+				cr.Tests = append(cr.Tests, id)
+			}
+			sort.Ints(cr.Tests)
+			crs = append(crs, cr)
+		}
+		sort.Slice(crs, func(i, j int) bool {
+			if crs[i].Start != crs[j].Start {
+				return crs[i].Start < crs[j].Start
+			}
+			return crs[i].End < crs[j].End
+		})
+		m.Files[file] = crs
+	}
+	m.index = make(map[string]map[git.LineRange]map[int]struct{})
+}
+
+// Lookup returns the tests that executed any of the lines changed by the
+// supplied hunks. Since the map was built at the base commit, only the base
+// side of each hunk is used: replaced lines must overlap a known executable
+// range, and lines inserted without replacing anything must fall inside one.
+// If the file isn't in the map, or any hunk can't be placed (as when a new
+// function is added between existing ones), the map can't say which tests
+// are affected and Lookup returns false.
+func (m *CoverageMap) Lookup(file string, hunks []git.Hunk) ([]TestID, bool) {
+	ranges, ok := m.Files[file]
+	if !ok {
+		return nil, false
+	}
+	ids := make(map[int]struct{})
+	for _, h := range hunks {
+		// A pure insertion follows line OldStart, so it's only executed along
+		// with the block containing both that line and the next.
+		lr, replaced := h.Removed()
+		if !replaced {
+			lr = git.LineRange{Start: h.OldStart, End: h.OldStart + 1}
+		}
+		overlaps := false
+		for _, cr := range ranges {
+			if replaced && (cr.Start > lr.End || cr.End < lr.Start) {
+				continue
+			}
+			if !replaced && (cr.Start > lr.Start || cr.End < lr.End) {
+				continue
+			}
+			overlaps = true
+			for _, id := range cr.Tests {
+				ids[id] = struct{}{}
+			}
+		}
+		if !overlaps {
+			return nil, false
+		}
+	}
+	tests := make([]TestID, 0, len(ids))
+	for id := range ids {
+		if id < len(m.Tests) {
+			tests = append(tests, m.Tests[id])
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].Package != tests[j].Package {
+			return tests[i].Package < tests[j].Package
+		}
+		return tests[i].Test < tests[j].Test
+	})
+	return tests, true
+}
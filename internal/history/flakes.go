@@ -0,0 +1,90 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/gotest"
+)
+
+const flakesFile = "flakes.json"
+
+// A Flake summarizes the flaky runs of a single test.
+type Flake struct {
+	Package  string      `json:"package"`
+	Test     string      `json:"test"`
+	Count    int         `json:"count"`
+	Recent   []time.Time `json:"recent"`
+	LastSeen time.Time   `json:"last_seen"`
+}
+
+// Flakes records every test that's failed and then passed on retry.
+type Flakes struct {
+	Tests []*Flake `json:"tests"`
+}
+
+// Flakes loads the stored flake records.
+func (s *Store) Flakes() (*Flakes, error) {
+	f := &Flakes{}
+	if err := s.read(flakesFile, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SaveFlakes persists the supplied flake records.
+func (s *Store) SaveFlakes(f *Flakes) error {
+	return s.write(flakesFile, f)
+}
+
+// Record adds an occurrence for each of the supplied flaky tests.
+func (f *Flakes) Record(flaky []gotest.FlakyTest, at time.Time) {
+	for _, ft := range flaky {
+		flake := f.find(ft.Package, ft.Test)
+		if flake == nil {
+			flake = &Flake{Package: ft.Package, Test: ft.Test}
+			f.Tests = append(f.Tests, flake)
+		}
+		flake.Count++
+		flake.LastSeen = at
+		flake.Recent = append(flake.Recent, at)
+		if len(flake.Recent) > maxSamples {
+			flake.Recent = flake.Recent[len(flake.Recent)-maxSamples:]
+		}
+	}
+}
+
+// Since returns the number of times the test flaked at or after the supplied
+// time. Only recent occurrences are retained, so the count is approximate for
+// very flaky tests.
+func (f *Flake) Since(t time.Time) int {
+	n := 0
+	for _, at := range f.Recent {
+		if !at.Before(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// Flakiest returns the flake records, ordered from most to least frequent.
+func (f *Flakes) Flakiest() []*Flake {
+	sorted := make([]*Flake, len(f.Tests))
+	copy(sorted, f.Tests)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].LastSeen.After(sorted[j].LastSeen)
+	})
+	return sorted
+}
+
+func (f *Flakes) find(pkg, test string) *Flake {
+	for _, flake := range f.Tests {
+		if flake.Package == pkg && flake.Test == test {
+			return flake
+		}
+	}
+	return nil
+}
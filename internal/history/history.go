@@ -0,0 +1,76 @@
+// Package history persists information about past runs in a local store,
+// which is usually kept in the repository's .git directory.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akshayjshah/hardhat/internal/hhlog"
+)
+
+// A Store is a directory of JSON documents.
+type Store struct {
+	logger *hhlog.Logger
+	dir    string
+}
+
+// Open returns a store rooted in the supplied directory. The directory is
+// created lazily, the first time the store is written.
+func Open(logger *hhlog.Logger, dir string) *Store {
+	return &Store{logger: logger, dir: dir}
+}
+
+// Dir returns the store's directory.
+func (s *Store) Dir() string { return s.dir }
+
+// read decodes the named document into v. Missing documents leave v
+// untouched.
+func (s *Store) read(name string, v interface{}) error {
+	path := filepath.Join(s.dir, name)
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.logger.Debugf("no history in %q yet", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read history from %q: %v", path, err)
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return fmt.Errorf("can't parse history in %q: %v", path, err)
+	}
+	return nil
+}
+
+// write atomically replaces the named document with the JSON encoding of v.
+func (s *Store) write(name string, v interface{}) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("can't create history directory: %v", err)
+	}
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, name)
+	tmp, err := ioutil.TempFile(s.dir, name)
+	if err != nil {
+		return fmt.Errorf("can't write history to %q: %v", path, err)
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("can't write history to %q: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("can't write history to %q: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("can't write history to %q: %v", path, err)
+	}
+	s.logger.Debugf("wrote history to %q", path)
+	return nil
+}
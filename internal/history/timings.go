@@ -0,0 +1,188 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/gotest"
+)
+
+const (
+	timingsFile = "timings.json"
+	// Keep enough samples for a meaningful rolling median, but not so many
+	// that the store grows without bound.
+	maxSamples = 50
+)
+
+// A Sample records how long a package or test took in a single run.
+type Sample struct {
+	Time    time.Time     `json:"time"`
+	Elapsed time.Duration `json:"elapsed"`
+	Failed  bool          `json:"failed,omitempty"`
+}
+
+// PackageTimings holds the samples for a package and its tests, oldest
+// first.
+type PackageTimings struct {
+	Samples []Sample            `json:"samples"`
+	Tests   map[string][]Sample `json:"tests,omitempty"`
+}
+
+// Timings holds samples for every package that's been tested.
+type Timings struct {
+	Packages map[string]*PackageTimings `json:"packages"`
+}
+
+// Timings loads the stored timings.
+func (s *Store) Timings() (*Timings, error) {
+	t := &Timings{}
+	if err := s.read(timingsFile, t); err != nil {
+		return nil, err
+	}
+	if t.Packages == nil {
+		t.Packages = make(map[string]*PackageTimings)
+	}
+	return t, nil
+}
+
+// SaveTimings persists the supplied timings.
+func (s *Store) SaveTimings(t *Timings) error {
+	return s.write(timingsFile, t)
+}
+
+// Record adds the packages and tests in a report to the timings. Skipped
+// packages and tests aren't recorded, since their durations aren't
+// meaningful.
+func (t *Timings) Record(r gotest.Report, at time.Time) {
+	for _, pkg := range r.Packages {
+		if !recordable(pkg.Result) {
+			continue
+		}
+		pt, ok := t.Packages[pkg.Path]
+		if !ok {
+			pt = &PackageTimings{}
+			t.Packages[pkg.Path] = pt
+		}
+		pt.Samples = appendSample(pt.Samples, Sample{
+			Time:    at,
+			Elapsed: pkg.Elapsed,
+			Failed:  pkg.Result == gotest.ResultFail,
+		})
+		for _, test := range pkg.Tests {
+			if !recordable(test.Result) {
+				continue
+			}
+			if pt.Tests == nil {
+				pt.Tests = make(map[string][]Sample)
+			}
+			pt.Tests[test.Name] = appendSample(pt.Tests[test.Name], Sample{
+				Time:    at,
+				Elapsed: test.Elapsed,
+				Failed:  test.Result == gotest.ResultFail,
+			})
+		}
+	}
+}
+
+// FailureRate returns the fraction of the package's most recent runs that
+// failed, considering at most window runs.
+func (pt *PackageTimings) FailureRate(window int) float64 {
+	samples := recent(pt.Samples, window)
+	if len(samples) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, s := range samples {
+		if s.Failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(samples))
+}
+
+// Estimate returns the median duration of the package's most recent runs,
+// considering at most window runs.
+func (pt *PackageTimings) Estimate(window int) time.Duration {
+	return Median(recent(pt.Samples, window))
+}
+
+// PackageNames returns the names of all packages with recorded timings, in
+// sorted order.
+func (t *Timings) PackageNames() []string {
+	names := make([]string, 0, len(t.Packages))
+	for name := range t.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Trend compares the most recent sample to the rolling median of the
+// samples that preceded it.
+type Trend struct {
+	Runs   int           `json:"runs"`
+	Latest time.Duration `json:"latest"`
+	Median time.Duration `json:"median"`
+}
+
+// NewTrend computes a trend from samples, using at most window samples before
+// the latest one to compute the median.
+func NewTrend(samples []Sample, window int) Trend {
+	if len(samples) == 0 {
+		return Trend{}
+	}
+	t := Trend{
+		Runs:   len(samples),
+		Latest: samples[len(samples)-1].Elapsed,
+	}
+	t.Median = Median(recent(samples[:len(samples)-1], window))
+	return t
+}
+
+// Change returns the latest sample's change relative to the median as a
+// fraction; 0.5 means that the latest run was 50% slower than usual. Trends
+// without a median report no change.
+func (t Trend) Change() float64 {
+	if t.Median <= 0 {
+		return 0
+	}
+	return float64(t.Latest-t.Median) / float64(t.Median)
+}
+
+// Median returns the median duration of the supplied samples.
+func Median(samples []Sample) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	ds := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		ds[i] = s.Elapsed
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	mid := len(ds) / 2
+	if len(ds)%2 == 1 {
+		return ds[mid]
+	}
+	return (ds[mid-1] + ds[mid]) / 2
+}
+
+// recent returns at most the last window samples. A non-positive window
+// returns all the samples.
+func recent(samples []Sample, window int) []Sample {
+	if window > 0 && len(samples) > window {
+		return samples[len(samples)-window:]
+	}
+	return samples
+}
+
+func appendSample(samples []Sample, s Sample) []Sample {
+	samples = append(samples, s)
+	if len(samples) > maxSamples {
+		samples = samples[len(samples)-maxSamples:]
+	}
+	return samples
+}
+
+func recordable(r gotest.Result) bool {
+	return r == gotest.ResultPass || r == gotest.ResultFail
+}
@@ -0,0 +1,51 @@
+package history
+
+import "github.com/akshayjshah/hardhat/internal/vet"
+
+const vetResultsFile = "vet.json"
+
+// A VetResult caches the diagnostics reported for a package.
+type VetResult struct {
+	// Hash identifies the package's source, the source of the project
+	// packages it imports, and the vet configuration.
+	Hash        string           `json:"hash"`
+	Diagnostics []vet.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// VetResults caches the most recent vet result for each package, keyed by
+// import path.
+type VetResults struct {
+	Packages map[string]VetResult `json:"packages"`
+}
+
+// VetResults loads the cached vet results.
+func (s *Store) VetResults() (*VetResults, error) {
+	v := &VetResults{}
+	if err := s.read(vetResultsFile, v); err != nil {
+		return nil, err
+	}
+	if v.Packages == nil {
+		v.Packages = make(map[string]VetResult)
+	}
+	return v, nil
+}
+
+// SaveVetResults persists the supplied vet results.
+func (s *Store) SaveVetResults(v *VetResults) error {
+	return s.write(vetResultsFile, v)
+}
+
+// Lookup returns the cached diagnostics for a package, if they were recorded
+// with the same hash.
+func (v *VetResults) Lookup(pkg, hash string) ([]vet.Diagnostic, bool) {
+	r, ok := v.Packages[pkg]
+	if !ok || r.Hash != hash {
+		return nil, false
+	}
+	return r.Diagnostics, true
+}
+
+// Record caches the diagnostics for a package, replacing any previous result.
+func (v *VetResults) Record(pkg, hash string, diags []vet.Diagnostic) {
+	v.Packages[pkg] = VetResult{Hash: hash, Diagnostics: diags}
+}
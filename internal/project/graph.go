@@ -0,0 +1,163 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Graph is the import graph of the project's own packages.
+type Graph struct {
+	Packages []string `json:"packages"`
+	Edges    []Edge   `json:"edges"`
+}
+
+// An Edge records that one package imports another.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Test is set if only the importing package's tests use the import.
+	Test bool `json:"test,omitempty"`
+}
+
+// Graph returns the import graph of the project's packages. Imports of the
+// standard library, vendored code, and other projects are omitted.
+func (p *Project) Graph() (*Graph, error) {
+	ig, err := p.graph()
+	if err != nil {
+		return nil, fmt.Errorf("can't build project's import graph: %v", err)
+	}
+	g := &Graph{}
+	for _, pkg := range ig.packages {
+		if p.owns(pkg) {
+			g.Packages = append(g.Packages, pkg)
+		}
+	}
+	edges := make(map[Edge]struct{})
+	for pkg, importers := range ig.importers {
+		for _, importer := range importers {
+			if p.owns(pkg) && p.owns(importer) {
+				edges[Edge{From: importer, To: pkg}] = struct{}{}
+			}
+		}
+	}
+	for pkg, importers := range ig.testImporters {
+		for _, importer := range importers {
+			if !p.owns(pkg) || !p.owns(importer) {
+				continue
+			}
+			if _, ok := edges[Edge{From: importer, To: pkg}]; !ok {
+				edges[Edge{From: importer, To: pkg, Test: true}] = struct{}{}
+			}
+		}
+	}
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	g.sort()
+	return g, nil
+}
+
+// owns reports whether a package is part of the project, rather than
+// vendored or external.
+func (p *Project) owns(pkg string) bool {
+	if pkg != p.Root() && !strings.HasPrefix(pkg, p.Root()+"/") {
+		return false
+	}
+	return !strings.Contains(pkg+"/", "/vendor/")
+}
+
+// WithoutTests returns a copy of the graph without the imports used only by
+// tests.
+func (g *Graph) WithoutTests() *Graph {
+	out := &Graph{Packages: g.Packages}
+	for _, e := range g.Edges {
+		if !e.Test {
+			out.Edges = append(out.Edges, e)
+		}
+	}
+	return out
+}
+
+// Around returns the subgraph of packages within depth imports of pkg, in
+// either direction. A depth of zero includes every package connected to pkg.
+func (g *Graph) Around(pkg string, depth int) *Graph {
+	neighbors := make(map[string][]string)
+	for _, e := range g.Edges {
+		neighbors[e.From] = append(neighbors[e.From], e.To)
+		neighbors[e.To] = append(neighbors[e.To], e.From)
+	}
+	distance := map[string]int{pkg: 0}
+	queue := []string{pkg}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if depth > 0 && distance[cur] == depth {
+			continue
+		}
+		for _, next := range neighbors[cur] {
+			if _, ok := distance[next]; !ok {
+				distance[next] = distance[cur] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	out := &Graph{}
+	for _, p := range g.Packages {
+		if _, ok := distance[p]; ok {
+			out.Packages = append(out.Packages, p)
+		}
+	}
+	for _, e := range g.Edges {
+		_, from := distance[e.From]
+		_, to := distance[e.To]
+		if from && to {
+			out.Edges = append(out.Edges, e)
+		}
+	}
+	return out
+}
+
+// Collapse merges packages that rename maps to the same name. Imports within
+// a merged group are dropped, and an edge between groups is a test edge only
+// if every import it stands for is.
+func (g *Graph) Collapse(rename func(string) string) *Graph {
+	packages := make(map[string]struct{})
+	for _, p := range g.Packages {
+		packages[rename(p)] = struct{}{}
+	}
+	type key struct{ from, to string }
+	test := make(map[key]bool)
+	for _, e := range g.Edges {
+		k := key{rename(e.From), rename(e.To)}
+		if k.from == k.to {
+			continue
+		}
+		if prev, ok := test[k]; ok {
+			test[k] = prev && e.Test
+		} else {
+			test[k] = e.Test
+		}
+	}
+
+	out := &Graph{}
+	for p := range packages {
+		out.Packages = append(out.Packages, p)
+	}
+	for k, t := range test {
+		out.Edges = append(out.Edges, Edge{From: k.from, To: k.to, Test: t})
+	}
+	out.sort()
+	return out
+}
+
+func (g *Graph) sort() {
+	sort.Strings(g.Packages)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
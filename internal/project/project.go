@@ -23,7 +23,13 @@ type deps struct {
 	Imports      []string
 	TestImports  []string
 	XTestImports []string
-	Deps         []string
+}
+
+// importGraph maps each package to the packages that import it.
+type importGraph struct {
+	packages      []string // every package go list found
+	importers     map[string][]string
+	testImporters map[string][]string // only from _test.go files
 }
 
 // Status describes the state of a file or package relative to a previous
@@ -62,6 +68,13 @@ func (s Status) MarshalText() ([]byte, error) {
 type PathDiff struct {
 	Status Status `json:"status"`
 	Path   string `json:"path"`
+	// Distance is the number of imports between an affected package and the
+	// nearest modified package. It's zero for modified packages and for
+	// files.
+	Distance int `json:"distance,omitempty"`
+	// Contexts lists the targets in which a package is affected, if the diff
+	// was computed for particular targets.
+	Contexts []string `json:"contexts,omitempty"`
 }
 
 func (pd PathDiff) less(other PathDiff) bool {
@@ -76,6 +89,8 @@ func (pd PathDiff) less(other PathDiff) bool {
 type Diff struct {
 	Files    []PathDiff `json:"files"`
 	Packages []PathDiff `json:"packages"`
+	// Contexts lists the targets the diff was computed for, if any.
+	Contexts []string `json:"contexts,omitempty"`
 
 	recursive bool
 }
@@ -100,6 +115,10 @@ func (d Diff) String() string {
 	} else {
 		fmt.Fprintf(buf, "%d modified or deleted packages:\n", len(d.Packages))
 		for _, pd := range d.Packages {
+			if len(d.Contexts) > 0 {
+				fmt.Fprintf(buf, "\t%s\t%s\t(%s)\n", pd.Status, pd.Path, strings.Join(pd.Contexts, ", "))
+				continue
+			}
 			fmt.Fprintf(buf, "\t%s\t%s\n", pd.Status, pd.Path)
 		}
 	}
@@ -111,6 +130,8 @@ type Project struct {
 	logger *hhlog.Logger
 	repo   *git.Repository
 	root   string
+	ctx    build.Context
+	target *Target
 }
 
 // New constructs a project.
@@ -118,6 +139,7 @@ func New(logger *hhlog.Logger, r *git.Repository) (*Project, error) {
 	p := &Project{
 		logger: logger,
 		repo:   r,
+		ctx:    build.Default,
 	}
 	if err := p.setRoot(); err != nil {
 		return nil, fmt.Errorf("can't determine root package: %v", err)
@@ -128,6 +150,9 @@ func New(logger *hhlog.Logger, r *git.Repository) (*Project, error) {
 // Root returns the Go import path of the project's root package.
 func (p *Project) Root() string { return p.root }
 
+// Dir returns the absolute path to the project's root directory.
+func (p *Project) Dir() string { return p.repo.Root() }
+
 // Diff identifies the files and packages directly modified since the supplied
 // commitish.
 func (p *Project) Diff(since string) (Diff, error) {
@@ -135,7 +160,7 @@ func (p *Project) Diff(since string) (Diff, error) {
 	if err != nil {
 		return Diff{}, err
 	}
-	return p.processDiff(raw)
+	return p.processDiff(raw, since)
 }
 
 // RecursiveDiff identifies the files and packages directly modified since the
@@ -145,23 +170,53 @@ func (p *Project) RecursiveDiff(since string) (Diff, error) {
 	if err != nil {
 		return Diff{}, err
 	}
+	return p.Expand(base)
+}
 
+// Expand adds any packages that depend on the diff's packages to the diff.
+func (p *Project) Expand(base Diff) (Diff, error) {
 	g, err := p.graph()
 	if err != nil {
 		return Diff{}, fmt.Errorf("can't build project's import graph: %v", err)
 	}
 
-	affected := make(map[PathDiff]struct{})
+	affected := make(map[string]PathDiff, len(base.Packages))
+	var queue []string
 	for _, pd := range base.Packages {
-		affected[pd] = struct{}{}
-		for _, dep := range g[pd.Path] {
-			affected[PathDiff{StatusModified, dep}] = struct{}{}
+		affected[pd.Path] = pd
+		queue = append(queue, pd.Path)
+	}
+	visit := func(pkg string, distance int) bool {
+		if pd, ok := affected[pkg]; ok && pd.Distance <= distance {
+			return false
+		}
+		affected[pkg] = PathDiff{Status: StatusModified, Path: pkg, Distance: distance}
+		return true
+	}
+	// Non-test imports are transitive, so walk them breadth-first.
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		for _, importer := range g.importers[pkg] {
+			if visit(importer, affected[pkg].Distance+1) {
+				queue = append(queue, importer)
+			}
+		}
+	}
+	// Imports from tests only affect the importing package.
+	reached := make([]PathDiff, 0, len(affected))
+	for _, pd := range affected {
+		reached = append(reached, pd)
+	}
+	for _, pd := range reached {
+		for _, importer := range g.testImporters[pd.Path] {
+			visit(importer, pd.Distance+1)
 		}
 	}
 
 	base.Packages = make([]PathDiff, 0, len(affected))
-	for pkg := range affected {
-		base.Packages = append(base.Packages, pkg)
+	for _, pd := range affected {
+		base.Packages = append(base.Packages, pd)
 	}
 	sort.Slice(base.Packages, func(i, j int) bool {
 		return base.Packages[i].less(base.Packages[j])
@@ -170,47 +225,209 @@ func (p *Project) RecursiveDiff(since string) (Diff, error) {
 	return base, nil
 }
 
+// Canonicalize converts the supplied commitish to a SHA1.
+func (p *Project) Canonicalize(commitish string) (string, error) {
+	return p.repo.Canonicalize(commitish)
+}
+
+// Dirty reports whether the working tree has uncommitted changes, including
+// untracked files.
+func (p *Project) Dirty() (bool, error) {
+	return p.repo.Dirty()
+}
+
+// Describe names HEAD after the most recent reachable tag, falling back to an
+// abbreviated SHA1.
+func (p *Project) Describe() (string, error) {
+	return p.repo.Describe()
+}
+
+// Branch returns the name of the current branch, or an empty string if HEAD
+// is detached.
+func (p *Project) Branch() (string, error) {
+	return p.repo.Branch()
+}
+
+// MergeBase returns the SHA1 of the best common ancestor of HEAD and the
+// supplied commitish.
+func (p *Project) MergeBase(commitish string) (string, error) {
+	return p.repo.MergeBase("HEAD", commitish)
+}
+
+// Worktree checks out the supplied commitish into a temporary working tree.
+// In GOPATH mode, the working tree is placed in a temporary GOPATH so that
+// the project's import paths resolve to it; the returned environment
+// selects that GOPATH. Call the cleanup function to remove the working tree.
+func (p *Project) Worktree(commitish string) (dir string, env []string, cleanup func(), err error) {
+	tmp, err := ioutil.TempDir("", "hardhat-worktree")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	env = os.Environ()
+	dir = filepath.Join(tmp, "tree")
+	if !exists(filepath.Join(p.repo.Root(), "go.mod")) {
+		dir = filepath.Join(tmp, "src", filepath.FromSlash(p.Root()))
+		gopath := tmp
+		if orig := build.Default.GOPATH; orig != "" {
+			gopath += string(filepath.ListSeparator) + orig
+		}
+		env = append(env, "GOPATH="+gopath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, nil, err
+	}
+	if err := p.repo.AddWorktree(dir, commitish); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, nil, err
+	}
+	cleanup = func() {
+		if err := p.repo.RemoveWorktree(dir); err != nil {
+			p.logger.Printf("Couldn't remove worktree %q: %v", dir, err)
+		}
+		os.RemoveAll(tmp)
+	}
+	return dir, env, cleanup, nil
+}
+
+// Existed reports whether a file or directory, relative to the repository
+// root, existed as of the supplied commitish.
+func (p *Project) Existed(commitish, path string) bool {
+	return p.repo.Exists(commitish, path)
+}
+
+// Show returns the contents of a file, relative to the repository root, as of
+// the supplied commitish. If the file didn't exist then, it returns nil.
+func (p *Project) Show(commitish, path string) ([]byte, error) {
+	return p.repo.Show(commitish, path)
+}
+
+// ChangedLines returns the lines added or modified since the supplied
+// commitish, keyed by the path of the file relative to the repository root.
+func (p *Project) ChangedLines(since string) (map[string][]git.LineRange, error) {
+	return p.repo.ChangedLines(since)
+}
+
+// Hunks returns the changes made to each file since the supplied commitish,
+// keyed by path relative to the repository root.
+func (p *Project) Hunks(since string) (map[string][]git.Hunk, error) {
+	return p.repo.Hunks(since)
+}
+
 // All identifies all the files and packages in the project.
 func (p *Project) All() (Diff, error) {
 	raw, err := p.repo.All()
 	if err != nil {
 		return Diff{}, err
 	}
-	return p.processDiff(raw)
+	return p.processDiff(raw, "")
+}
+
+// ChangeCounts returns the number of times each package's files were
+// modified in the most recent commits. Directories that aren't packages are
+// ignored.
+func (p *Project) ChangeCounts(commits int) (map[string]int, error) {
+	files, err := p.repo.ChangeCounts(commits)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]int)
+	for f, n := range files {
+		dirs[filepath.Dir(f)] += n
+	}
+	counts := make(map[string]int, len(dirs))
+	for dir, n := range dirs {
+		if !exists(filepath.Join(p.repo.Root(), dir)) {
+			continue
+		}
+		pkg, err := p.ImportPath(dir)
+		if err != nil {
+			continue
+		}
+		counts[pkg] += n
+	}
+	return counts, nil
+}
+
+// ImportPath returns the import path of the package in the supplied
+// directory, which must be relative to the repository root.
+func (p *Project) ImportPath(dir string) (string, error) {
+	if dir == "." {
+		return p.Root(), nil
+	}
+	pkg, err := p.ctx.Import(fmt.Sprintf("./%s", dir), p.repo.Root(), build.FindOnly)
+	if err != nil {
+		return "", fmt.Errorf("Go tool can't import directory %q: %v", dir, err)
+	}
+	return pkg.ImportPath, nil
+}
+
+// Package returns information about a package in the project, including the
+// source files that match the project's target.
+func (p *Project) Package(importPath string) (*build.Package, error) {
+	pkg, err := p.ctx.Import("./"+filepath.ToSlash(p.PackageDir(importPath)), p.repo.Root(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("Go tool can't import package %q: %v", importPath, err)
+	}
+	return pkg, nil
+}
+
+// PackageDir returns the directory containing a package in the project,
+// relative to the repository root.
+func (p *Project) PackageDir(importPath string) string {
+	if importPath == p.Root() {
+		return "."
+	}
+	return filepath.FromSlash(strings.TrimPrefix(importPath, p.Root()+"/"))
 }
 
 // Exec executes a command, sending the output directly to standard out and
 // standard error.
 func (p *Project) Exec(cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
-	c.Dir = p.repo.Root()
+	c := p.Command(cmd, args...)
 	c.Stdout, c.Stderr = os.Stdout, os.Stderr
 	return c.Run()
 }
 
-func (p *Project) processDiff(raw git.Diff) (Diff, error) {
+// Command prepares a command to run from the repository root.
+func (p *Project) Command(cmd string, args ...string) *exec.Cmd {
+	p.logger.Debugf("running %s %s", cmd, strings.Join(args, " "))
+	c := exec.Command(cmd, args...)
+	c.Dir = p.repo.Root()
+	c.Env = p.Environ(os.Environ())
+	return c
+}
+
+// processDiff finds the packages containing changed files. Deleted files are
+// read from the since commitish, so that their build constraints can be
+// checked.
+func (p *Project) processDiff(raw git.Diff, since string) (Diff, error) {
 	d := Diff{
 		Files:    make([]PathDiff, 0, len(raw.Modified)),
 		Packages: make([]PathDiff, 0, len(raw.Deleted)),
 	}
 	for _, mod := range raw.Modified {
-		d.Files = append(d.Files, PathDiff{StatusModified, mod})
+		d.Files = append(d.Files, PathDiff{Status: StatusModified, Path: mod})
 	}
 	for _, del := range raw.Deleted {
-		d.Files = append(d.Files, PathDiff{StatusDeleted, del})
+		d.Files = append(d.Files, PathDiff{Status: StatusDeleted, Path: del})
 	}
 
 	dirs := make(map[string]struct{})
 	for _, f := range raw.Deleted {
-		dirs[filepath.Dir(f)] = struct{}{}
+		if p.matchedAt(since, f) {
+			dirs[filepath.Dir(f)] = struct{}{}
+		}
 	}
 	for _, f := range raw.Modified {
-		dirs[filepath.Dir(f)] = struct{}{}
+		if p.matches(f) {
+			dirs[filepath.Dir(f)] = struct{}{}
+		}
 	}
 
 	for dir := range dirs {
 		if !exists(dir) {
-			d.Packages = append(d.Packages, PathDiff{StatusDeleted, filepath.Join(p.Root(), dir)})
+			d.Packages = append(d.Packages, PathDiff{Status: StatusDeleted, Path: filepath.Join(p.Root(), dir)})
 			continue
 		}
 
@@ -220,7 +437,11 @@ func (p *Project) processDiff(raw git.Diff) (Diff, error) {
 			dir = filepath.Dir(dir)
 		}
 
-		pkg, importErr := build.Import(fmt.Sprintf("./%s", dir), p.repo.Root(), build.ImportComment)
+		pkg, importErr := p.ctx.Import(fmt.Sprintf("./%s", dir), p.repo.Root(), build.ImportComment)
+		if _, ok := importErr.(*build.NoGoError); ok && p.target != nil {
+			// The target's build constraints exclude the whole package.
+			continue
+		}
 		if importErr != nil {
 			contains, err := containsGo(filepath.Join(p.repo.Root(), dir))
 			if err != nil {
@@ -234,9 +455,9 @@ func (p *Project) processDiff(raw git.Diff) (Diff, error) {
 		}
 
 		if dir == "." {
-			d.Packages = append(d.Packages, PathDiff{StatusModified, p.Root()})
+			d.Packages = append(d.Packages, PathDiff{Status: StatusModified, Path: p.Root()})
 		} else {
-			d.Packages = append(d.Packages, PathDiff{StatusModified, pkg.ImportPath})
+			d.Packages = append(d.Packages, PathDiff{Status: StatusModified, Path: pkg.ImportPath})
 		}
 	}
 	sort.Slice(d.Packages, func(i, j int) bool {
@@ -273,30 +494,41 @@ func (p *Project) setRoot() error {
 	return nil
 }
 
-func (p *Project) graph() (map[string][]string, error) {
+func (p *Project) graph() (importGraph, error) {
 	out := bytes.NewBuffer(nil)
-	cmd := exec.Command("go", "list", "-json", "./...")
+	args := []string{"list", "-json"}
+	if p.target != nil && len(p.target.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(p.target.Tags, ","))
+	}
+	cmd := exec.Command("go", append(args, "./...")...)
 	cmd.Dir = p.repo.Root()
+	cmd.Env = p.Environ(os.Environ())
 	cmd.Stderr, cmd.Stdout = out, out
 	if err := cmd.Run(); err != nil {
-		return nil, err
+		return importGraph{}, err
 	}
 
-	dependencies := make(map[string][]string)
+	g := importGraph{
+		importers:     make(map[string][]string),
+		testImporters: make(map[string][]string),
+	}
 	dec := json.NewDecoder(out)
 	for dec.More() {
 		var d deps
 		if err := dec.Decode(&d); err != nil {
-			return nil, err
+			return importGraph{}, err
 		}
-		d.Deps = append(d.Deps, d.Imports...)
-		d.Deps = append(d.Deps, d.TestImports...)
-		d.Deps = append(d.Deps, d.XTestImports...)
-		for _, pkg := range d.Deps {
-			dependencies[pkg] = append(dependencies[pkg], d.ImportPath)
+		g.packages = append(g.packages, d.ImportPath)
+		for _, pkg := range d.Imports {
+			g.importers[pkg] = append(g.importers[pkg], d.ImportPath)
+		}
+		for _, pkg := range append(d.TestImports, d.XTestImports...) {
+			if pkg != d.ImportPath {
+				g.testImporters[pkg] = append(g.testImporters[pkg], d.ImportPath)
+			}
 		}
 	}
-	return dependencies, nil
+	return g, nil
 }
 
 func exists(path string) bool {
@@ -0,0 +1,166 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A Target is a platform and set of build tags. Analyzing a project for a
+// target ignores files that the target's build constraints exclude.
+type Target struct {
+	GOOS   string   `json:"goos"`
+	GOARCH string   `json:"goarch"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// ParseTarget parses a target in the form "GOOS/GOARCH", optionally followed
+// by a colon and comma-separated build tags.
+func ParseTarget(s string) (Target, error) {
+	platform, tags := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		platform, tags = s[:i], s[i+1:]
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Target{}, fmt.Errorf("invalid target %q: expected GOOS/GOARCH", s)
+	}
+	t := Target{GOOS: parts[0], GOARCH: parts[1]}
+	if tags != "" {
+		t.Tags = strings.Split(tags, ",")
+	}
+	return t, nil
+}
+
+// Platform returns the target's platform in the form "GOOS/GOARCH".
+func (t Target) Platform() string {
+	return t.GOOS + "/" + t.GOARCH
+}
+
+func (t Target) String() string {
+	if len(t.Tags) == 0 {
+		return t.Platform()
+	}
+	return t.Platform() + ":" + strings.Join(t.Tags, ",")
+}
+
+// cross reports whether the target differs from the host platform.
+func (t Target) cross() bool {
+	return t.GOOS != runtime.GOOS || t.GOARCH != runtime.GOARCH
+}
+
+// WithTarget returns a copy of the project that analyzes packages as the go
+// tool would build them for the supplied target, and whose commands run with
+// the target's GOOS and GOARCH. Without a target, projects conservatively
+// treat every file as part of its package.
+func (p *Project) WithTarget(t Target) *Project {
+	cp := *p
+	cp.target = &t
+	cp.ctx.GOOS = t.GOOS
+	cp.ctx.GOARCH = t.GOARCH
+	cp.ctx.BuildTags = t.Tags
+	if t.cross() {
+		// Like the go tool, don't use cgo when cross-compiling unless asked.
+		cp.ctx.CgoEnabled = os.Getenv("CGO_ENABLED") == "1"
+	}
+	return &cp
+}
+
+// Target returns the project's target, if it has one.
+func (p *Project) Target() (Target, bool) {
+	if p.target == nil {
+		return Target{}, false
+	}
+	return *p.target, true
+}
+
+// Environ adds the settings for the project's target to an environment, like
+// the one returned by os.Environ.
+func (p *Project) Environ(env []string) []string {
+	if p.target == nil {
+		return env
+	}
+	env = append(env[:len(env):len(env)], "GOOS="+p.target.GOOS, "GOARCH="+p.target.GOARCH)
+	if p.target.cross() && os.Getenv("CGO_ENABLED") == "" {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	return env
+}
+
+// matches reports whether a file, relative to the repository root, belongs
+// to the project's target. Files that aren't Go source, and files that can't
+// be read, match every target.
+func (p *Project) matches(file string) bool {
+	if p.target == nil || !strings.HasSuffix(file, ".go") {
+		return true
+	}
+	dir, name := filepath.Split(file)
+	ok, err := p.ctx.MatchFile(filepath.Join(p.repo.Root(), dir), name)
+	return err != nil || ok
+}
+
+// matchedAt is like matches, but checks the file as of the supplied
+// commitish. It's used for deleted files.
+func (p *Project) matchedAt(commitish, file string) bool {
+	if p.target == nil || !strings.HasSuffix(file, ".go") {
+		return true
+	}
+	src, err := p.repo.Show(commitish, file)
+	if err != nil || src == nil {
+		return true
+	}
+	ctx := p.ctx
+	ctx.OpenFile = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(src)), nil
+	}
+	dir, name := filepath.Split(file)
+	ok, err := ctx.MatchFile(filepath.Join(p.repo.Root(), dir), name)
+	return err != nil || ok
+}
+
+// ForTargets computes a diff for each target and merges the results. Each
+// package in the merged diff lists the targets it's affected in, and is only
+// included if at least one target builds a changed file in it.
+func (p *Project) ForTargets(targets []Target, diff func(*Project) (Diff, error)) (Diff, error) {
+	var merged Diff
+	packages := make(map[string]*PathDiff)
+	for _, t := range targets {
+		d, err := diff(p.WithTarget(t))
+		if err != nil {
+			return Diff{}, fmt.Errorf("can't analyze %s: %v", t, err)
+		}
+		merged.Files = d.Files
+		merged.recursive = d.recursive
+		merged.Contexts = append(merged.Contexts, t.String())
+		for _, pd := range d.Packages {
+			prev, ok := packages[pd.Path]
+			if !ok {
+				pd := pd
+				pd.Contexts = []string{t.String()}
+				packages[pd.Path] = &pd
+				continue
+			}
+			prev.Contexts = append(prev.Contexts, t.String())
+			if pd.Status == StatusModified {
+				prev.Status = StatusModified
+			}
+			if pd.Distance < prev.Distance {
+				prev.Distance = pd.Distance
+			}
+		}
+	}
+	merged.Packages = make([]PathDiff, 0, len(packages))
+	for _, pd := range packages {
+		merged.Packages = append(merged.Packages, *pd)
+	}
+	sort.Slice(merged.Packages, func(i, j int) bool {
+		return merged.Packages[i].less(merged.Packages[j])
+	})
+	return merged, nil
+}
@@ -0,0 +1,139 @@
+// Package quarantine loads the list of known-flaky tests whose failures
+// shouldn't fail a run. Every entry has an owner and an expiry date, so
+// quarantined tests can't be forgotten indefinitely.
+package quarantine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultPath is the location of the quarantine file, relative to the
+// repository root.
+const DefaultPath = ".hardhat/quarantine.json"
+
+const dateFormat = "2006-01-02"
+
+// An Entry quarantines the tests matching a pattern.
+type Entry struct {
+	// Package is an import path, optionally including "..." wildcards.
+	Package string `json:"package"`
+	// Test is a regular expression matched against the full test name. If
+	// it's empty, every test in the package is quarantined.
+	Test    string `json:"test,omitempty"`
+	Owner   string `json:"owner"`
+	Expires string `json:"expires"` // YYYY-MM-DD
+	Reason  string `json:"reason,omitempty"`
+
+	pkg     *regexp.Regexp
+	test    *regexp.Regexp
+	expires time.Time
+}
+
+func (e *Entry) String() string {
+	if e.Test == "" {
+		return e.Package
+	}
+	return fmt.Sprintf("%s %s", e.Package, e.Test)
+}
+
+// Expired reports whether the entry has expired. Entries remain valid
+// through the end of their expiry date.
+func (e *Entry) Expired(now time.Time) bool {
+	return !now.Before(e.expires.AddDate(0, 0, 1))
+}
+
+// Matches reports whether the entry quarantines the supplied test. A
+// subtest is quarantined if its top-level test is.
+func (e *Entry) Matches(pkg, test string) bool {
+	if !e.pkg.MatchString(pkg) {
+		return false
+	}
+	if e.test == nil {
+		return true
+	}
+	if e.test.MatchString(test) {
+		return true
+	}
+	if i := strings.Index(test, "/"); i >= 0 {
+		return e.test.MatchString(test[:i])
+	}
+	return false
+}
+
+func (e *Entry) compile() error {
+	if e.Package == "" {
+		return fmt.Errorf("quarantine entry must specify a package")
+	}
+	if e.Owner == "" {
+		return fmt.Errorf("quarantine entry %q must specify an owner", e)
+	}
+	expires, err := time.ParseInLocation(dateFormat, e.Expires, time.Local)
+	if err != nil {
+		return fmt.Errorf("quarantine entry %q has invalid expiry date %q: %v", e, e.Expires, err)
+	}
+	e.expires = expires
+	e.pkg = regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(e.Package), `\.\.\.`, ".*", -1) + "$")
+	if e.Test != "" {
+		test, err := regexp.Compile("^(?:" + e.Test + ")$")
+		if err != nil {
+			return fmt.Errorf("quarantine entry %q has invalid test pattern: %v", e, err)
+		}
+		e.test = test
+	}
+	return nil
+}
+
+// A List is a collection of quarantine entries.
+type List struct {
+	Entries []*Entry `json:"quarantine"`
+}
+
+// Load reads a quarantine list from a file. A missing file is treated as an
+// empty list.
+func Load(path string) (*List, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &List{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read quarantine file: %v", err)
+	}
+	var l List
+	if err := json.Unmarshal(bs, &l); err != nil {
+		return nil, fmt.Errorf("can't parse quarantine file %q: %v", path, err)
+	}
+	for _, e := range l.Entries {
+		if err := e.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &l, nil
+}
+
+// Expired returns the entries that have expired.
+func (l *List) Expired(now time.Time) []*Entry {
+	var expired []*Entry
+	for _, e := range l.Entries {
+		if e.Expired(now) {
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+// Match returns the first entry that quarantines the supplied test, or nil
+// if the test isn't quarantined.
+func (l *List) Match(pkg, test string) *Entry {
+	for _, e := range l.Entries {
+		if e.Matches(pkg, test) {
+			return e
+		}
+	}
+	return nil
+}
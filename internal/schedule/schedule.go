@@ -0,0 +1,135 @@
+// Package schedule decides the order in which packages are tested, so that
+// the failures a change is most likely to cause show up first.
+package schedule
+
+import (
+	"sort"
+	"time"
+
+	"github.com/akshayjshah/hardhat/internal/history"
+	"github.com/akshayjshah/hardhat/internal/project"
+)
+
+const (
+	// Only recent history is a good predictor of a package's behavior.
+	window = 20
+	// Packages without any history are assumed to take this long, unless
+	// other packages' history suggests otherwise.
+	defaultEstimate = 10 * time.Second
+)
+
+// A Candidate is a package that may need to be tested.
+type Candidate struct {
+	Path string `json:"path"`
+	// Distance is the number of imports between the package and the nearest
+	// modified package.
+	Distance    int           `json:"distance"`
+	FailureRate float64       `json:"failure_rate"`
+	Estimate    time.Duration `json:"estimate"`
+	// Changes is the number of recent commits that modified the package.
+	Changes int `json:"changes"`
+	// Known is true if the package's estimate came from its own history.
+	Known bool `json:"known"`
+}
+
+// Candidates returns the modified and affected packages in a diff, annotated
+// with their test history.
+func Candidates(d project.Diff, t *history.Timings) []Candidate {
+	cs := make([]Candidate, 0, len(d.Packages))
+	for _, pd := range d.Packages {
+		if pd.Status != project.StatusModified {
+			continue
+		}
+		c := Candidate{Path: pd.Path, Distance: pd.Distance}
+		if pt, ok := t.Packages[pd.Path]; ok && len(pt.Samples) > 0 {
+			c.FailureRate = pt.FailureRate(window)
+			c.Estimate = pt.Estimate(window)
+			c.Known = true
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Prioritize sorts candidates so that directly modified packages come first,
+// followed by their dependents in order of graph distance. Within each tier,
+// packages that failed more often recently come first; ties go to slower
+// packages, since starting them early keeps the total run short.
+func Prioritize(cs []Candidate) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		a, b := cs[i], cs[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		if a.Estimate != b.Estimate {
+			return a.Estimate > b.Estimate
+		}
+		return a.Path < b.Path
+	})
+}
+
+// Rank sorts candidates by how valuable it is to test them, most valuable
+// first. A candidate's score adds together its proximity to the
+// modified code, its recent failure rate, and how often it changes relative
+// to the other candidates; each term ranges from zero to one. The ordering
+// is fully deterministic, with ties broken by import path.
+func Rank(cs []Candidate) {
+	maxChanges := 0
+	for _, c := range cs {
+		if c.Changes > maxChanges {
+			maxChanges = c.Changes
+		}
+	}
+	score := func(c Candidate) float64 {
+		s := 1/float64(1+c.Distance) + c.FailureRate
+		if maxChanges > 0 {
+			s += float64(c.Changes) / float64(maxChanges)
+		}
+		return s
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		si, sj := score(cs[i]), score(cs[j])
+		if si != sj {
+			return si > sj
+		}
+		return cs[i].Path < cs[j].Path
+	})
+}
+
+// Select chooses the highest-ranked candidates whose estimated durations fit
+// within the supplied capacity. Candidates are considered in rank order, and
+// any candidate that doesn't fit is skipped in favor of cheaper ones further
+// down the list. Candidates without history are assumed to take as long as
+// the median candidate with history.
+func Select(cs []Candidate, capacity time.Duration) (selected, skipped []Candidate) {
+	fill := fallbackEstimate(cs)
+	var used time.Duration
+	for _, c := range cs {
+		if !c.Known {
+			c.Estimate = fill
+		}
+		if used+c.Estimate > capacity {
+			skipped = append(skipped, c)
+			continue
+		}
+		used += c.Estimate
+		selected = append(selected, c)
+	}
+	return selected, skipped
+}
+
+func fallbackEstimate(cs []Candidate) time.Duration {
+	var samples []history.Sample
+	for _, c := range cs {
+		if c.Known {
+			samples = append(samples, history.Sample{Elapsed: c.Estimate})
+		}
+	}
+	if len(samples) == 0 {
+		return defaultEstimate
+	}
+	return history.Median(samples)
+}
@@ -0,0 +1,44 @@
+package vet
+
+import (
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/atomicalign"
+	"golang.org/x/tools/go/analysis/passes/deepequalerrors"
+	"golang.org/x/tools/go/analysis/passes/fieldalignment"
+	"golang.org/x/tools/go/analysis/passes/httpmux"
+	"golang.org/x/tools/go/analysis/passes/nilness"
+	"golang.org/x/tools/go/analysis/passes/reflectvaluecompare"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/sortslice"
+	"golang.org/x/tools/go/analysis/passes/unusedwrite"
+	"golang.org/x/tools/go/analysis/suite/vet"
+)
+
+// Standard is the set of analyzers that go vet runs by default.
+var Standard = vet.Suite
+
+// Optional analyzers are too noisy or too slow for go vet, but can be
+// enabled in the configuration file.
+var Optional = []*analysis.Analyzer{
+	atomicalign.Analyzer,
+	deepequalerrors.Analyzer,
+	fieldalignment.Analyzer,
+	httpmux.Analyzer,
+	nilness.Analyzer,
+	reflectvaluecompare.Analyzer,
+	shadow.Analyzer,
+	sortslice.Analyzer,
+	unusedwrite.Analyzer,
+}
+
+// lookup finds a standard or optional analyzer by name.
+func lookup(name string) *analysis.Analyzer {
+	for _, set := range [][]*analysis.Analyzer{Standard, Optional} {
+		for _, a := range set {
+			if a.Name == name {
+				return a
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package vet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// DefaultPath is the location of the vet configuration file, relative to the
+// repository root.
+const DefaultPath = ".hardhat/vet.json"
+
+// A Config selects the analyzers to run.
+type Config struct {
+	// Enable lists analyzers to run in addition to the standard vet passes,
+	// like "shadow" or "nilness".
+	Enable []string `json:"enable,omitempty"`
+	// Disable lists standard vet passes to skip.
+	Disable []string `json:"disable,omitempty"`
+	// Flags set analyzer flags, keyed like "printf.funcs".
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Load reads a vet configuration from a file. A missing file is treated as
+// an empty configuration, which runs only the standard passes.
+func Load(path string) (*Config, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read vet config: %v", err)
+	}
+	var c Config
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("can't parse vet config %q: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Analyzers returns the configured analyzers, sorted by name, with their
+// flags set.
+func (c *Config) Analyzers() ([]*analysis.Analyzer, error) {
+	selected := make(map[string]*analysis.Analyzer)
+	for _, a := range Standard {
+		selected[a.Name] = a
+	}
+	for _, name := range c.Disable {
+		if _, ok := selected[name]; !ok {
+			return nil, fmt.Errorf("can't disable %q: not a standard vet pass", name)
+		}
+		delete(selected, name)
+	}
+	for _, name := range c.Enable {
+		a := lookup(name)
+		if a == nil {
+			return nil, fmt.Errorf("can't enable %q: unknown analyzer", name)
+		}
+		selected[name] = a
+	}
+	for key, value := range c.Flags {
+		i := strings.Index(key, ".")
+		if i < 0 {
+			return nil, fmt.Errorf("analyzer flag %q must be prefixed with the analyzer's name", key)
+		}
+		a, ok := selected[key[:i]]
+		if !ok {
+			return nil, fmt.Errorf("can't set flag %q: analyzer %q isn't enabled", key, key[:i])
+		}
+		if err := a.Flags.Set(key[i+1:], value); err != nil {
+			return nil, fmt.Errorf("can't set flag %q: %v", key, err)
+		}
+	}
+
+	analyzers := make([]*analysis.Analyzer, 0, len(selected))
+	for _, a := range selected {
+		analyzers = append(analyzers, a)
+	}
+	sort.Slice(analyzers, func(i, j int) bool { return analyzers[i].Name < analyzers[j].Name })
+	return analyzers, nil
+}
+
+// String describes the configuration, for use in cache keys.
+func (c *Config) String() string {
+	keys := make([]string, 0, len(c.Flags))
+	for k := range c.Flags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	flags := make([]string, len(keys))
+	for i, k := range keys {
+		flags[i] = k + "=" + c.Flags[k]
+	}
+	return fmt.Sprintf("enable %q disable %q flags %q", c.Enable, c.Disable, flags)
+}
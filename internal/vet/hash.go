@@ -0,0 +1,141 @@
+package vet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A Hasher identifies everything that vet's results for a package depend
+// on: the package's own source, including its tests, and the non-test source
+// of every local package it imports, directly or indirectly.
+//
+// Tests can import packages that import the package under test, so the
+// imports of a package and its tests can form cycles. Non-test imports
+// can't, so each package's key covers the closure of its non-test imports
+// rather than the keys of its dependencies.
+type Hasher struct {
+	// Seed covers everything other than source that affects the results.
+	Seed []byte
+	// Import finds a package by import path.
+	Import func(importPath string) (*build.Package, error)
+	// Local reports whether an import path belongs to the project. Other
+	// packages are covered by the seed.
+	Local func(importPath string) bool
+
+	pkgs   map[string]*build.Package
+	source map[string]string
+}
+
+// Hash returns the key for a package's vet results.
+func (h *Hasher) Hash(importPath string) (string, error) {
+	pkg, err := h.load(importPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write(h.Seed)
+	if err := hashFiles(sum, pkg.Dir, pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles, pkg.XTestGoFiles); err != nil {
+		return "", err
+	}
+	deps := make(map[string]struct{})
+	for _, names := range [][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+		if err := h.closure(names, deps); err != nil {
+			return "", err
+		}
+	}
+	sorted := make([]string, 0, len(deps))
+	for dep := range deps {
+		sorted = append(sorted, dep)
+	}
+	sort.Strings(sorted)
+	for _, dep := range sorted {
+		src, err := h.sourceHash(dep)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(sum, "import %s %s\n", dep, src)
+	}
+	return fmt.Sprintf("%x", sum.Sum(nil)), nil
+}
+
+// closure adds the local packages among the imports, and everything they
+// import outside of tests, to deps.
+func (h *Hasher) closure(imports []string, deps map[string]struct{}) error {
+	for _, imp := range imports {
+		if _, ok := deps[imp]; ok || !h.Local(imp) {
+			continue
+		}
+		deps[imp] = struct{}{}
+		pkg, err := h.load(imp)
+		if err != nil {
+			return err
+		}
+		if err := h.closure(pkg.Imports, deps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceHash hashes a package's non-test source, without its dependencies.
+func (h *Hasher) sourceHash(importPath string) (string, error) {
+	if sum, ok := h.source[importPath]; ok {
+		return sum, nil
+	}
+	pkg, err := h.load(importPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	if err := hashFiles(sum, pkg.Dir, pkg.GoFiles, pkg.CgoFiles); err != nil {
+		return "", err
+	}
+	if h.source == nil {
+		h.source = make(map[string]string)
+	}
+	h.source[importPath] = fmt.Sprintf("%x", sum.Sum(nil))
+	return h.source[importPath], nil
+}
+
+func (h *Hasher) load(importPath string) (*build.Package, error) {
+	if pkg, ok := h.pkgs[importPath]; ok {
+		return pkg, nil
+	}
+	pkg, err := h.Import(importPath)
+	if err != nil {
+		return nil, err
+	}
+	if h.pkgs == nil {
+		h.pkgs = make(map[string]*build.Package)
+	}
+	h.pkgs[importPath] = pkg
+	return pkg, nil
+}
+
+// hashFiles writes the names and contents of the files in dir to w, in
+// sorted order.
+func hashFiles(w io.Writer, dir string, names ...[]string) error {
+	var files []string
+	for _, n := range names {
+		files = append(files, n...)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "file %s\n", name)
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
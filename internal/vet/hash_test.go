@@ -0,0 +1,83 @@
+package vet
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestHasher(dir string) *Hasher {
+	return &Hasher{
+		Seed: []byte("seed"),
+		Import: func(importPath string) (*build.Package, error) {
+			rel := strings.TrimPrefix(importPath, "example.com/p")
+			return build.ImportDir(filepath.Join(dir, filepath.FromSlash(rel)), 0)
+		},
+		Local: func(importPath string) bool {
+			return strings.HasPrefix(importPath, "example.com/p/")
+		},
+	}
+}
+
+func TestHasherTestImportCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hardhat-vet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a's external test imports b, which imports a.
+	writeFiles(t, dir, map[string]string{
+		"a/a.go":      "package a\n\nfunc A() {}\n",
+		"a/a_test.go": "package a_test\n\nimport \"example.com/p/b\"\n\nvar _ = b.B\n",
+		"b/b.go":      "package b\n\nimport \"example.com/p/a\"\n\nfunc B() { a.A() }\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) {}\n",
+	})
+	hashes := func() (a, b string) {
+		h := newTestHasher(dir)
+		// Hashing a first used to record b's dependency on a as empty.
+		a, err := h.Hash("example.com/p/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err = h.Hash("example.com/p/b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a, b
+	}
+
+	a1, b1 := hashes()
+	if a2, b2 := hashes(); a1 != a2 || b1 != b2 {
+		t.Fatalf("hashes aren't stable")
+	}
+
+	writeFiles(t, dir, map[string]string{"a/a.go": "package a\n\nfunc A(int) {}\n"})
+	a2, b2 := hashes()
+	if a2 == a1 {
+		t.Errorf("a's hash didn't change when its source did")
+	}
+	if b2 == b1 {
+		t.Errorf("b's hash didn't change when a, which it imports, did")
+	}
+
+	// b's tests don't affect how a is type-checked.
+	writeFiles(t, dir, map[string]string{"b/b_test.go": "package b\n"})
+	if a3, b3 := hashes(); a3 != a2 || b3 == b2 {
+		t.Errorf("changing b's tests should change only b's hash")
+	}
+}
@@ -0,0 +1,82 @@
+package vet
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// A Loader describes how to load packages for analysis.
+type Loader struct {
+	// Dir is the directory in which to run the go tool.
+	Dir string
+	// Env is the go tool's environment.
+	Env []string
+	// Filename converts absolute file names to the form used in
+	// diagnostics, usually relative to the repository root.
+	Filename func(string) string
+}
+
+// Run type-checks the packages matching the supplied patterns, along with
+// their tests, and runs the analyzers on them in process. Diagnostics
+// reported for both a package and its test variant are only returned once,
+// and diagnostics in external tests belong to the package they test.
+func (l Loader) Run(patterns []string, analyzers []*analysis.Analyzer) ([]Diagnostic, error) {
+	cfg := &packages.Config{
+		Mode:  packages.LoadAllSyntax,
+		Dir:   l.Dir,
+		Env:   l.Env,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("can't load packages: %v", err)
+	}
+	var roots []*packages.Package
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.PkgPath, ".test") {
+			// The generated main package for a test binary.
+			continue
+		}
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("can't load %s: %v", pkg.ID, pkg.Errors[0])
+		}
+		roots = append(roots, pkg)
+	}
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	graph, err := checker.Analyze(analyzers, roots, nil)
+	if err != nil {
+		return nil, err
+	}
+	var diags []Diagnostic
+	for _, act := range graph.Roots {
+		pkg := strings.TrimSuffix(act.Package.PkgPath, "_test")
+		if act.Err != nil {
+			return nil, fmt.Errorf("%s failed on %s: %v", act.Analyzer.Name, pkg, act.Err)
+		}
+		for _, ad := range act.Diagnostics {
+			posn := act.Package.Fset.Position(ad.Pos)
+			d := Diagnostic{
+				Package:  pkg,
+				Analyzer: act.Analyzer.Name,
+				File:     posn.Filename,
+				Line:     posn.Line,
+				Column:   posn.Column,
+				Message:  ad.Message,
+			}
+			if l.Filename != nil {
+				d.File = l.Filename(d.File)
+			}
+			diags = append(diags, d)
+		}
+	}
+	diags = Unique(diags)
+	Sort(diags)
+	return diags, nil
+}
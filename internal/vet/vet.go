@@ -0,0 +1,101 @@
+// Package vet runs go/analysis analyzers in process and formats the
+// diagnostics they report.
+package vet
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Diagnostic is a single problem reported by an analyzer.
+type Diagnostic struct {
+	Package  string `json:"package"`
+	Analyzer string `json:"analyzer"`
+	// File is relative to the repository root.
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.position(), d.Message, d.Analyzer)
+}
+
+func (d Diagnostic) position() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// Unique removes duplicate diagnostics, preserving order.
+func Unique(diags []Diagnostic) []Diagnostic {
+	seen := make(map[Diagnostic]struct{}, len(diags))
+	unique := diags[:0]
+	for _, d := range diags {
+		if _, ok := seen[d]; !ok {
+			seen[d] = struct{}{}
+			unique = append(unique, d)
+		}
+	}
+	return unique
+}
+
+// Sort orders diagnostics by position.
+func Sort(diags []Diagnostic) {
+	sort.Slice(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Analyzer < b.Analyzer
+	})
+}
+
+// WriteText writes one diagnostic per line, in the format used by the go
+// tool.
+func WriteText(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGitHub writes diagnostics as GitHub Actions workflow commands, so
+// that they're shown as annotations on pull requests.
+func WriteGitHub(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		props := fmt.Sprintf("file=%s,line=%d", escapeProperty(d.File), d.Line)
+		if d.Column > 0 {
+			props += fmt.Sprintf(",col=%d", d.Column)
+		}
+		props += ",title=" + escapeProperty("vet: "+d.Analyzer)
+		if _, err := fmt.Fprintf(w, "::error %s::%s\n", props, escapeData(d.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeData(s string) string {
+	s = strings.Replace(s, "%", "%25", -1)
+	s = strings.Replace(s, "\r", "%0D", -1)
+	return strings.Replace(s, "\n", "%0A", -1)
+}
+
+func escapeProperty(s string) string {
+	s = escapeData(s)
+	s = strings.Replace(s, ":", "%3A", -1)
+	return strings.Replace(s, ",", "%2C", -1)
+}
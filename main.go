@@ -16,7 +16,7 @@ func main() {
 		os.Exit(1)
 	}
 	if _, err := c.Parse(os.Args[1:]); err != nil {
-		logger.Printf(err.Error())
+		logger.Printf("%s", err)
 		os.Exit(1)
 	}
 }